@@ -37,6 +37,10 @@ func (c *Communicator) Start(cmd *packer.RemoteCmd) error {
 		return err
 	}
 
+	cmd.SetAbort(func() {
+		localCmd.Process.Kill()
+	})
+
 	go func() {
 		exitStatus := 0
 		if err := localCmd.Wait(); err != nil {
@@ -129,3 +133,34 @@ func (c *Communicator) Download(src string, w io.Writer) error {
 
 	return nil
 }
+
+func (c *Communicator) DownloadDir(src string, dst string, exclude []string) error {
+	if src == "" {
+		return fmt.Errorf("Source directory to download can't be empty")
+	}
+
+	if len(exclude) > 0 {
+		return fmt.Errorf("Excluding files isn't supported when downloading from a chroot")
+	}
+
+	// Same trailing slash semantics as UploadDir: copy the contents
+	// of "src" rather than the directory itself.
+	chrootSrc := filepath.Join(c.Chroot, src)
+	if src[len(src)-1] == '/' {
+		chrootSrc = chrootSrc + "/."
+	}
+
+	// Make sure the destination exists so that "cp" copies into it
+	// rather than creating it as the copy.
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	log.Printf("Downloading directory '%s' to '%s'", chrootSrc, dst)
+	cpCmd, err := c.CmdWrapper(fmt.Sprintf("cp -R '%s' '%s'", chrootSrc, dst))
+	if err != nil {
+		return err
+	}
+
+	return ShellCommand(cpCmd).Run()
+}
@@ -12,3 +12,15 @@ func TestCommunicator_ImplementsCommunicator(t *testing.T) {
 		t.Fatalf("Communicator should be a communicator")
 	}
 }
+
+func TestCommunicatorDownloadDir_badArgs(t *testing.T) {
+	c := &Communicator{Chroot: "/mnt/packer"}
+
+	if err := c.DownloadDir("", "/tmp/dst", nil); err == nil {
+		t.Fatal("should error with an empty source")
+	}
+
+	if err := c.DownloadDir("/etc/", "/tmp/dst", []string{"*.conf"}); err == nil {
+		t.Fatal("should error with exclusions")
+	}
+}
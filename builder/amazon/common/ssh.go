@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/mitchellh/goamz/ec2"
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common"
 	"time"
 )
 
@@ -49,8 +50,8 @@ func SSHAddress(e *ec2.EC2, port int) func(multistep.StateBag) (string, error) {
 
 // SSHConfig returns a function that can be used for the SSH communicator
 // config for connecting to the instance created over SSH using the generated
-// private key.
-func SSHConfig(username string) func(multistep.StateBag) (*ssh.ClientConfig, error) {
+// private key, along with any keys from the SSH connect configuration.
+func SSHConfig(username string, connConfig *common.SSHConnectConfig) func(multistep.StateBag) (*ssh.ClientConfig, error) {
 	return func(state multistep.StateBag) (*ssh.ClientConfig, error) {
 		privateKey := state.Get("privateKey").(string)
 
@@ -62,7 +63,7 @@ func SSHConfig(username string) func(multistep.StateBag) (*ssh.ClientConfig, err
 		return &ssh.ClientConfig{
 			User: username,
 			Auth: []ssh.AuthMethod{
-				ssh.PublicKeys(signer),
+				connConfig.KeyAuth(signer).AuthMethod(),
 			},
 		}, nil
 	}
@@ -20,11 +20,12 @@ import (
 const BuilderId = "mitchellh.amazonebs"
 
 type config struct {
-	common.PackerConfig    `mapstructure:",squash"`
-	awscommon.AccessConfig `mapstructure:",squash"`
-	awscommon.AMIConfig    `mapstructure:",squash"`
-	awscommon.BlockDevices `mapstructure:",squash"`
-	awscommon.RunConfig    `mapstructure:",squash"`
+	common.PackerConfig     `mapstructure:",squash"`
+	common.SSHConnectConfig `mapstructure:",squash"`
+	awscommon.AccessConfig  `mapstructure:",squash"`
+	awscommon.AMIConfig     `mapstructure:",squash"`
+	awscommon.BlockDevices  `mapstructure:",squash"`
+	awscommon.RunConfig     `mapstructure:",squash"`
 
 	tpl *packer.ConfigTemplate
 }
@@ -44,7 +45,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.config.tpl.UserVars = b.config.PackerUserVars
+	b.config.ConfigureTemplate(b.config.tpl)
 	b.config.tpl.Funcs(awscommon.TemplateFuncs)
 
 	// Accumulate any errors
@@ -52,6 +53,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	errs = packer.MultiErrorAppend(errs, b.config.AccessConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.AMIConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.RunConfig.Prepare(b.config.tpl)...)
+	errs = packer.MultiErrorAppend(errs, b.config.SSHConnectConfig.Prepare(b.config.tpl)...)
 
 	if errs != nil && len(errs.Errors) > 0 {
 		return nil, errs
@@ -114,8 +116,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		},
 		&common.StepConnectSSH{
 			SSHAddress:     awscommon.SSHAddress(ec2conn, b.config.SSHPort),
-			SSHConfig:      awscommon.SSHConfig(b.config.SSHUsername),
+			SSHConfig:      awscommon.SSHConfig(b.config.SSHUsername, &b.config.SSHConnectConfig),
 			SSHWaitTimeout: b.config.SSHTimeout(),
+			Config:         &b.config.SSHConnectConfig,
 		},
 		&common.StepProvision{},
 		&stepStopInstance{},
@@ -135,14 +138,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	}
 
 	// Run!
-	if b.config.PackerDebug {
-		b.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		b.runner = &multistep.BasicRunner{Steps: steps}
-	}
+	b.runner = common.NewRunner(steps, b.config.PackerConfig, ui)
 
 	b.runner.Run(state)
 
@@ -22,11 +22,12 @@ const BuilderId = "mitchellh.amazon.instance"
 // Config is the configuration that is chained through the steps and
 // settable from the template.
 type Config struct {
-	common.PackerConfig    `mapstructure:",squash"`
-	awscommon.AccessConfig `mapstructure:",squash"`
-	awscommon.AMIConfig    `mapstructure:",squash"`
-	awscommon.BlockDevices `mapstructure:",squash"`
-	awscommon.RunConfig    `mapstructure:",squash"`
+	common.PackerConfig     `mapstructure:",squash"`
+	common.SSHConnectConfig `mapstructure:",squash"`
+	awscommon.AccessConfig  `mapstructure:",squash"`
+	awscommon.AMIConfig     `mapstructure:",squash"`
+	awscommon.BlockDevices  `mapstructure:",squash"`
+	awscommon.RunConfig     `mapstructure:",squash"`
 
 	AccountId           string `mapstructure:"account_id"`
 	BundleDestination   string `mapstructure:"bundle_destination"`
@@ -56,7 +57,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.config.tpl.UserVars = b.config.PackerUserVars
+	b.config.ConfigureTemplate(b.config.tpl)
 	b.config.tpl.Funcs(awscommon.TemplateFuncs)
 
 	if b.config.BundleDestination == "" {
@@ -100,6 +101,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	errs = packer.MultiErrorAppend(errs, b.config.AccessConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.AMIConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.RunConfig.Prepare(b.config.tpl)...)
+	errs = packer.MultiErrorAppend(errs, b.config.SSHConnectConfig.Prepare(b.config.tpl)...)
 
 	validates := map[string]*string{
 		"bundle_upload_command": &b.config.BundleUploadCommand,
@@ -218,8 +220,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		},
 		&common.StepConnectSSH{
 			SSHAddress:     awscommon.SSHAddress(ec2conn, b.config.SSHPort),
-			SSHConfig:      awscommon.SSHConfig(b.config.SSHUsername),
+			SSHConfig:      awscommon.SSHConfig(b.config.SSHUsername, &b.config.SSHConnectConfig),
 			SSHWaitTimeout: b.config.SSHTimeout(),
+			Config:         &b.config.SSHConnectConfig,
 		},
 		&common.StepProvision{},
 		&StepUploadX509Cert{},
@@ -241,14 +244,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	}
 
 	// Run!
-	if b.config.PackerDebug {
-		b.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		b.runner = &multistep.BasicRunner{Steps: steps}
-	}
+	b.runner = common.NewRunner(steps, b.config.PackerConfig, ui)
 
 	b.runner.Run(state)
 
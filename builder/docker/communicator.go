@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
 	"fmt"
 	"github.com/ActiveState/tail"
@@ -12,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -73,108 +75,145 @@ func (c *Communicator) Upload(dst string, src io.Reader) error {
 
 	// Copy the file into place by copying the temporary file we put
 	// into the shared folder into the proper location in the container
-	cmd := &packer.RemoteCmd{
-		Command: fmt.Sprintf("cp %s/%s %s", c.ContainerDir,
-			filepath.Base(tempfile.Name()), dst),
+	command := fmt.Sprintf("cp %s/%s %s", c.ContainerDir,
+		filepath.Base(tempfile.Name()), dst)
+	if err := c.runCommand(command); err != nil {
+		return fmt.Errorf("Upload failed: %s", err)
 	}
 
-	if err := c.Start(cmd); err != nil {
-		return err
+	return nil
+}
+
+func (c *Communicator) UploadDir(dst string, src string, exclude []string) error {
+	// If there is no trailing slash, the directory itself is put into
+	// the archive, otherwise only its contents are.
+	prefix := ""
+	if src[len(src)-1] != '/' {
+		prefix = filepath.Base(src)
 	}
 
-	// Wait for the copy to complete
-	cmd.Wait()
-	if cmd.ExitStatus != 0 {
-		return fmt.Errorf("Upload failed with non-zero exit status: %d", cmd.ExitStatus)
+	// Stream the directory as a tar archive into the container, where it
+	// is extracted as it comes in.
+	pr, pw := io.Pipe()
+	tarErrCh := make(chan error, 1)
+	go func() {
+		log.Printf("Archiving '%s' for upload to '%s'", src, dst)
+		err := tarDir(pw, src, prefix, exclude)
+		pw.CloseWithError(err)
+		tarErrCh <- err
+	}()
+
+	command := fmt.Sprintf("set -e; mkdir -p %s; tar -xf - -C %s", dst, dst)
+	err := c.execStream(command, pr, nil)
+
+	// Unblock the archiving if the command stopped reading early
+	pr.Close()
+	tarErr := <-tarErrCh
+
+	if err != nil {
+		return fmt.Errorf("Upload failed: %s", err)
+	}
+	if tarErr != nil {
+		return fmt.Errorf("Error archiving directory for upload: %s", tarErr)
 	}
 
 	return nil
 }
 
-func (c *Communicator) UploadDir(dst string, src string, exclude []string) error {
-	// Create the temporary directory that will store the contents of "src"
-	// for copying into the container.
-	td, err := ioutil.TempDir(c.HostDir, "dirupload")
+func (c *Communicator) Download(src string, dst io.Writer) error {
+	// Create the file on the host side first and only write to it from
+	// within the container, so it keeps our ownership and permissions.
+	tempfile, err := ioutil.TempFile(c.HostDir, "download")
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(td)
-
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	defer os.Remove(tempfile.Name())
+	defer tempfile.Close()
 
-		relpath, err := filepath.Rel(src, path)
-		if err != nil {
-			return err
-		}
-		hostpath := filepath.Join(td, relpath)
+	command := fmt.Sprintf("cat %s >%s",
+		src, filepath.Join(c.ContainerDir, filepath.Base(tempfile.Name())))
+	if err := c.runCommand(command); err != nil {
+		return fmt.Errorf("Download failed: %s", err)
+	}
 
-		// If it is a directory, just create it
-		if info.IsDir() {
-			return os.MkdirAll(hostpath, info.Mode())
-		}
+	_, err = io.Copy(dst, tempfile)
+	return err
+}
 
-		// It is a file, copy it over, including mode.
-		src, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer src.Close()
+func (c *Communicator) DownloadDir(src string, dst string, exclude []string) error {
+	// Same trailing slash semantics as UploadDir.
+	dir, name, prefix := filepath.Dir(src), filepath.Base(src), filepath.Base(src)
+	if src[len(src)-1] == '/' {
+		dir, name, prefix = src, ".", ""
+	}
 
-		dst, err := os.Create(hostpath)
-		if err != nil {
-			return err
-		}
-		defer dst.Close()
+	// Stream the directory as a tar archive out of the container,
+	// extracting it as it comes in.
+	pr, pw := io.Pipe()
+	execErrCh := make(chan error, 1)
+	go func() {
+		err := c.execStream(fmt.Sprintf("tar -cf - -C %s %s", dir, name), nil, pw)
+		pw.CloseWithError(err)
+		execErrCh <- err
+	}()
 
-		if _, err := io.Copy(dst, src); err != nil {
-			return err
-		}
+	log.Printf("Extracting '%s' to '%s'", src, dst)
+	err := untarDir(pr, dst, prefix, exclude)
+	if err == nil {
+		// Read the padding after the end of the archive
+		_, err = io.Copy(ioutil.Discard, pr)
+	}
 
-		si, err := src.Stat()
-		if err != nil {
-			return err
-		}
+	// Unblock the command if the extraction stopped reading early
+	pr.Close()
+	execErr := <-execErrCh
 
-		return dst.Chmod(si.Mode())
+	// A failed command also fails the extraction with the same error
+	if err != nil && err != execErr {
+		return fmt.Errorf("Error extracting downloaded directory: %s", err)
 	}
-
-	// Copy the entire directory tree to the temporary directory
-	if err := filepath.Walk(src, walkFn); err != nil {
-		return err
+	if execErr != nil {
+		return fmt.Errorf("Download failed: %s", execErr)
 	}
 
-	// Determine the destination directory
-	containerSrc := filepath.Join(c.ContainerDir, filepath.Base(td))
-	containerDst := dst
-	if src[len(src)-1] != '/' {
-		containerDst = filepath.Join(dst, filepath.Base(src))
-	}
+	return nil
+}
 
-	// Make the directory, then copy into it
-	cmd := &packer.RemoteCmd{
-		Command: fmt.Sprintf("set -e; mkdir -p %s; cp -R %s/* %s",
-			containerDst, containerSrc, containerDst),
+// execStream runs a shell command in the container with "docker exec",
+// connecting its standard input and output to stdin and stdout. Unlike
+// Start, nothing goes through the shared folder, so it can be used to
+// stream data into and out of the container.
+func (c *Communicator) execStream(command string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", "exec", "-i", c.ContainerId, "/bin/sh", "-c", command)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	log.Printf("Executing in container %s: %#v", c.ContainerId, command)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
 	}
+
+	return nil
+}
+
+// runCommand runs a command in the container and waits for it to
+// complete, returning an error if it exits non-zero.
+func (c *Communicator) runCommand(command string) error {
+	cmd := &packer.RemoteCmd{Command: command}
 	if err := c.Start(cmd); err != nil {
 		return err
 	}
 
-	// Wait for the copy to complete
 	cmd.Wait()
 	if cmd.ExitStatus != 0 {
-		return fmt.Errorf("Upload failed with non-zero exit status: %d", cmd.ExitStatus)
+		return fmt.Errorf("non-zero exit status: %d", cmd.ExitStatus)
 	}
 
 	return nil
 }
 
-func (c *Communicator) Download(src string, dst io.Writer) error {
-	panic("not implemented")
-}
-
 // Runs the given command and blocks until completion
 func (c *Communicator) run(cmd *exec.Cmd, remote *packer.RemoteCmd, stdin_w io.WriteCloser, outputFile *os.File, exitCodePath string) {
 	// For Docker, remote communication must be serialized since it
@@ -288,3 +327,209 @@ func (c *Communicator) run(cmd *exec.Cmd, remote *packer.RemoteCmd, stdin_w io.W
 	// Finally, we're done
 	remote.SetExited(int(exitStatus))
 }
+
+// tarDir writes the contents of the directory src as a tar archive to w,
+// with every path in the archive under prefix. Paths relative to src that
+// match any of the exclude patterns are skipped.
+func tarDir(w io.Writer, src string, prefix string, exclude []string) error {
+	tw := tar.NewWriter(w)
+
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relpath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		if relpath != "." && excluded(relpath, exclude) {
+			log.Printf("Skipping excluded path: %s", relpath)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		name := filepath.ToSlash(filepath.Join(prefix, relpath))
+		if name == "." {
+			// The root of the archive doesn't need an entry
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	}
+
+	if err := filepath.Walk(src, walkFn); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// untarDir extracts the tar archive read from r into the directory dst.
+// Paths in the archive, relative to prefix, that match any of the exclude
+// patterns are skipped.
+func untarDir(r io.Reader, dst string, prefix string, exclude []string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if name == "." {
+			continue
+		}
+
+		if name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) ||
+			filepath.IsAbs(name) {
+			return fmt.Errorf("Archive path outside of destination: %s", header.Name)
+		}
+
+		relpath, err := filepath.Rel(prefix, name)
+		if err != nil {
+			return err
+		}
+
+		if relpath != "." && (excluded(relpath, exclude) || excludedParent(relpath, exclude)) {
+			log.Printf("Skipping excluded path: %s", relpath)
+			continue
+		}
+
+		// Symlinks from the archive are created as they are, so never
+		// write through one, which could put files outside of dst.
+		if err := checkNoSymlinks(dst, name); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dst, name)
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(path)
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+
+			// Replace a symlink instead of writing to its target
+			if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+			}
+
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			log.Printf("Skipping unsupported archive entry: %s", header.Name)
+		}
+	}
+}
+
+// checkNoSymlinks returns an error if any of the parent directories of
+// the relative path within dst is a symlink.
+func checkNoSymlinks(dst string, name string) error {
+	parts := strings.Split(name, string(filepath.Separator))
+	current := dst
+	for i, part := range parts {
+		current = filepath.Join(current, part)
+		fi, err := os.Lstat(current)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		// The path itself may be a symlink, which is replaced rather than
+		// written through.
+		if i < len(parts)-1 && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Archive path goes through a symlink: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// excluded returns true if the relative path matches any of the
+// exclude patterns.
+func excluded(path string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludedParent returns true if any of the parent directories of the
+// relative path match the exclude patterns.
+func excludedParent(path string, exclude []string) bool {
+	for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+		if excluded(dir, exclude) {
+			return true
+		}
+	}
+
+	return false
+}
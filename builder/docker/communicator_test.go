@@ -1,10 +1,259 @@
 package docker
 
 import (
+	"archive/tar"
+	"bytes"
 	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 )
 
 func TestCommunicator_impl(t *testing.T) {
 	var _ packer.Communicator = new(Communicator)
 }
+
+// testFakeDocker puts a "docker" command first in the PATH that runs the
+// commands given to "docker exec" on the host instead, and returns the
+// function that restores the PATH.
+func testFakeDocker(t *testing.T) func() {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake docker command needs a POSIX shell")
+	}
+
+	bin, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	script := "#!/bin/sh\n" +
+		"[ \"$1\" = exec ] && [ \"$2\" = -i ] || exit 99\n" +
+		"shift 3\n" +
+		"exec \"$@\"\n"
+	if err := ioutil.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(bin)
+	}
+}
+
+func TestCommunicator_dirStreaming(t *testing.T) {
+	defer testFakeDocker(t)()
+
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	hostDir := filepath.Join(td, "shared")
+	if err := os.Mkdir(hostDir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	src := filepath.Join(td, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("foo"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c := &Communicator{
+		ContainerId:  "container",
+		HostDir:      hostDir,
+		ContainerDir: "/packer-files",
+	}
+
+	// The "container" is the host here
+	uploaded := filepath.Join(td, "uploaded")
+	if err := c.UploadDir(uploaded, src, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	downloaded := filepath.Join(td, "downloaded")
+	if err := c.DownloadDir(filepath.Join(uploaded, "src"), downloaded, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(downloaded, "src", "sub", "a.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "foo" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	// Nothing is staged in the shared folder
+	infos, err := ioutil.ReadDir(hostDir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(infos) != 0 {
+		t.Fatalf("staged files: %#v", infos)
+	}
+
+	// A failing command is reported
+	if err := c.DownloadDir(filepath.Join(td, "missing"), downloaded, nil); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestTarDir_roundTrip(t *testing.T) {
+	src, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		"a.txt":            "foo",
+		"sub/b.txt":        "bar",
+		"skipped/c.txt":    "baz",
+		"sub/skipped.log":  "qux",
+		"sub/deeper/d.txt": "quux",
+	}
+	for path, contents := range files {
+		path = filepath.Join(src, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := tarDir(&archive, src, "src", []string{"skipped"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dst, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := untarDir(&archive, dst, "src", []string{"sub/*.log"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"a.txt":            "foo",
+		"sub/b.txt":        "bar",
+		"sub/deeper/d.txt": "quux",
+	}
+	for path, contents := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dst, "src", path))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if string(data) != contents {
+			t.Fatalf("bad %s: %q", path, data)
+		}
+	}
+
+	for _, path := range []string{"skipped", "sub/skipped.log"} {
+		if _, err := os.Stat(filepath.Join(dst, "src", path)); err == nil {
+			t.Fatalf("%s should be excluded", path)
+		}
+	}
+}
+
+func TestUntarDir_outsideDestination(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: 0})
+	tw.Close()
+
+	dst, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := untarDir(&archive, dst, "", nil); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestUntarDir_symlinkEscape(t *testing.T) {
+	outside, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(outside)
+
+	// A link out of the destination, then a file written through it
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{
+		Name:     "link",
+		Typeflag: tar.TypeSymlink,
+		Linkname: outside,
+	})
+	tw.WriteHeader(&tar.Header{Name: "link/escape", Mode: 0644, Size: 3})
+	tw.Write([]byte("foo"))
+	tw.Close()
+
+	dst, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := untarDir(&archive, dst, "", nil); err == nil {
+		t.Fatal("should error")
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "escape")); err == nil {
+		t.Fatal("file should not be written outside of the destination")
+	}
+}
+
+func TestUntarDir_replacesSymlink(t *testing.T) {
+	outside, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(outside)
+
+	// A link to a file outside, then a file with the same name
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{
+		Name:     "file",
+		Typeflag: tar.TypeSymlink,
+		Linkname: filepath.Join(outside, "target"),
+	})
+	tw.WriteHeader(&tar.Header{Name: "file", Mode: 0644, Size: 3})
+	tw.Write([]byte("foo"))
+	tw.Close()
+
+	dst, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := untarDir(&archive, dst, "", nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "target")); err == nil {
+		t.Fatal("file should not be written through the symlink")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "file"))
+	if err != nil || string(data) != "foo" {
+		t.Fatalf("bad: %s %s", data, err)
+	}
+}
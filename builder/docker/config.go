@@ -29,7 +29,7 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 		return nil, nil, err
 	}
 
-	c.tpl.UserVars = c.PackerUserVars
+	c.ConfigureTemplate(c.tpl)
 
 	// Defaults
 	if len(c.RunCommand) == 0 {
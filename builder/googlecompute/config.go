@@ -14,7 +14,8 @@ import (
 // both the publicly settable state as well as the privately generated
 // state of the config object.
 type Config struct {
-	common.PackerConfig `mapstructure:",squash"`
+	common.PackerConfig     `mapstructure:",squash"`
+	common.SSHConnectConfig `mapstructure:",squash"`
 
 	BucketName        string            `mapstructure:"bucket_name"`
 	ClientSecretsFile string            `mapstructure:"client_secrets_file"`
@@ -55,10 +56,11 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	c.tpl.UserVars = c.PackerUserVars
+	c.ConfigureTemplate(c.tpl)
 
 	// Prepare the errors
 	errs := common.CheckUnusedConfig(md)
+	errs = packer.MultiErrorAppend(errs, c.SSHConnectConfig.Prepare(c.tpl)...)
 
 	// Set defaults.
 	if c.Network == "" {
@@ -26,7 +26,7 @@ func sshConfig(state multistep.StateBag) (*ssh.ClientConfig, error) {
 	return &ssh.ClientConfig{
 		User: config.SSHUsername,
 		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
+			config.KeyAuth(signer).AuthMethod(),
 		},
 	}, nil
 }
@@ -7,7 +7,8 @@ import (
 )
 
 type Config struct {
-	common.PackerConfig `mapstructure:",squash"`
+	common.PackerConfig     `mapstructure:",squash"`
+	common.SSHConnectConfig `mapstructure:",squash"`
 
 	Host              string `mapstructure:"host"`
 	Port              int    `mapstructure:"port"`
@@ -30,13 +31,14 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 		return nil, nil, err
 	}
 
-	c.tpl.UserVars = c.PackerUserVars
+	c.ConfigureTemplate(c.tpl)
 
 	if c.Port == 0 {
 		c.Port = 22
 	}
 
 	errs := common.CheckUnusedConfig(md)
+	errs = packer.MultiErrorAppend(errs, c.SSHConnectConfig.Prepare(c.tpl)...)
 
 	templates := map[string]*string{
 		"host":                 &c.Host,
@@ -64,9 +66,9 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 			fmt.Errorf("ssh_username must be specified"))
 	}
 
-	if c.SSHPassword == "" && c.SSHPrivateKeyFile == "" {
+	if c.SSHPassword == "" && c.SSHPrivateKeyFile == "" && !c.HasKeyAuth() {
 		errs = packer.MultiErrorAppend(errs,
-			fmt.Errorf("one of ssh_password and ssh_private_key_file must be specified"))
+			fmt.Errorf("one of ssh_password, ssh_private_key_file, ssh_private_key_files or ssh_agent_auth must be specified"))
 	}
 
 	if c.SSHPassword != "" && c.SSHPrivateKeyFile != "" {
@@ -1,6 +1,7 @@
 package null
 
 import (
+	"os"
 	"testing"
 )
 
@@ -106,4 +107,15 @@ func TestConfigPrepare_sshCredential(t *testing.T) {
 	raw["ssh_password"] = "bad"
 	_, warns, errs = NewConfig(raw)
 	testConfigErr(t, warns, errs)
+
+	// only ssh_agent_auth
+	old := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", old)
+	os.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+
+	delete(raw, "ssh_password")
+	delete(raw, "ssh_private_key_file")
+	raw["ssh_agent_auth"] = true
+	_, warns, errs = NewConfig(raw)
+	testConfigOk(t, warns, errs)
 }
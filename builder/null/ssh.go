@@ -4,8 +4,8 @@ import (
 	gossh "code.google.com/p/go.crypto/ssh"
 	"fmt"
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common"
 	"github.com/mitchellh/packer/communicator/ssh"
-	"io/ioutil"
 )
 
 // SSHAddress returns a function that can be given to the SSH communicator
@@ -18,41 +18,36 @@ func SSHAddress(host string, port int) func(multistep.StateBag) (string, error)
 
 // SSHConfig returns a function that can be used for the SSH communicator
 // config for connecting to the specified host via SSH
-// private_key_file has precedence over password!
-func SSHConfig(username string, password string, privateKeyFile string) func(multistep.StateBag) (*gossh.ClientConfig, error) {
+func SSHConfig(username string, password string, privateKeyFile string, connConfig *common.SSHConnectConfig) func(multistep.StateBag) (*gossh.ClientConfig, error) {
 	return func(state multistep.StateBag) (*gossh.ClientConfig, error) {
+		auth := make([]gossh.AuthMethod, 0, 3)
 
+		// key based auth, using the agent and any other keys as well
+		keys := connConfig.KeyAuth()
 		if privateKeyFile != "" {
-			// key based auth
-
-			bytes, err := ioutil.ReadFile(privateKeyFile)
+			signer, err := ssh.FileSigner(privateKeyFile)
 			if err != nil {
 				return nil, fmt.Errorf("Error setting up SSH config: %s", err)
 			}
-			privateKey := string(bytes)
 
-			signer, err := gossh.ParsePrivateKey([]byte(privateKey))
-			if err != nil {
-				return nil, fmt.Errorf("Error setting up SSH config: %s", err)
-			}
+			keys.Signers = append(keys.Signers, signer)
+		}
+
+		if !keys.Empty() {
+			auth = append(auth, keys.AuthMethod())
+		}
 
-			return &gossh.ClientConfig{
-				User: username,
-				Auth: []gossh.AuthMethod{
-					gossh.PublicKeys(signer),
-				},
-			}, nil
-		} else {
-			// password based auth
-
-			return &gossh.ClientConfig{
-				User: username,
-				Auth: []gossh.AuthMethod{
-					gossh.Password(password),
-					gossh.KeyboardInteractive(
-						ssh.PasswordKeyboardInteractive(password)),
-				},
-			}, nil
+		// password based auth
+		if password != "" {
+			auth = append(auth,
+				gossh.Password(password),
+				gossh.KeyboardInteractive(
+					ssh.PasswordKeyboardInteractive(password)))
 		}
+
+		return &gossh.ClientConfig{
+			User: username,
+			Auth: auth,
+		}, nil
 	}
 }
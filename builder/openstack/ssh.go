@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common"
 	"github.com/rackspace/gophercloud"
 	"time"
 )
@@ -48,8 +49,8 @@ func SSHAddress(csp gophercloud.CloudServersProvider, port int) func(multistep.S
 
 // SSHConfig returns a function that can be used for the SSH communicator
 // config for connecting to the instance created over SSH using the generated
-// private key.
-func SSHConfig(username string) func(multistep.StateBag) (*ssh.ClientConfig, error) {
+// private key, along with any keys from the SSH connect configuration.
+func SSHConfig(username string, connConfig *common.SSHConnectConfig) func(multistep.StateBag) (*ssh.ClientConfig, error) {
 	return func(state multistep.StateBag) (*ssh.ClientConfig, error) {
 		privateKey := state.Get("privateKey").(string)
 
@@ -61,7 +62,7 @@ func SSHConfig(username string) func(multistep.StateBag) (*ssh.ClientConfig, err
 		return &ssh.ClientConfig{
 			User: username,
 			Auth: []ssh.AuthMethod{
-				ssh.PublicKeys(signer),
+				connConfig.KeyAuth(signer).AuthMethod(),
 			},
 		}, nil
 	}
@@ -4,6 +4,7 @@ import (
 	"code.google.com/p/go.crypto/ssh"
 	"fmt"
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common"
 	packerssh "github.com/mitchellh/packer/communicator/ssh"
 	"io/ioutil"
 	"os"
@@ -26,7 +27,7 @@ func SSHAddress(state multistep.StateBag) (string, error) {
 	return fmt.Sprintf("%s:22", ip), nil
 }
 
-func SSHConfigFunc(config SSHConfig) func(multistep.StateBag) (*ssh.ClientConfig, error) {
+func SSHConfigFunc(config SSHConfig, connConfig *common.SSHConnectConfig) func(multistep.StateBag) (*ssh.ClientConfig, error) {
 	return func(state multistep.StateBag) (*ssh.ClientConfig, error) {
 		auth := []ssh.AuthMethod{
 			ssh.Password(config.SSHPassword),
@@ -34,13 +35,18 @@ func SSHConfigFunc(config SSHConfig) func(multistep.StateBag) (*ssh.ClientConfig
 				packerssh.PasswordKeyboardInteractive(config.SSHPassword)),
 		}
 
+		keys := connConfig.KeyAuth()
 		if config.SSHKeyPath != "" {
 			signer, err := sshKeyToSigner(config.SSHKeyPath)
 			if err != nil {
 				return nil, err
 			}
 
-			auth = append(auth, ssh.PublicKeys(signer))
+			keys.Signers = append(keys.Signers, signer)
+		}
+
+		if !keys.Empty() {
+			auth = append(auth, keys.AuthMethod())
 		}
 
 		return &ssh.ClientConfig{
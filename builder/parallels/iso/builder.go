@@ -20,6 +20,7 @@ type Builder struct {
 
 type config struct {
 	common.PackerConfig                 `mapstructure:",squash"`
+	common.SSHConnectConfig             `mapstructure:",squash"`
 	parallelscommon.FloppyConfig        `mapstructure:",squash"`
 	parallelscommon.OutputConfig        `mapstructure:",squash"`
 	parallelscommon.RunConfig           `mapstructure:",squash"`
@@ -42,6 +43,7 @@ type config struct {
 	HTTPPortMax             uint     `mapstructure:"http_port_max"`
 	ISOChecksum             string   `mapstructure:"iso_checksum"`
 	ISOChecksumType         string   `mapstructure:"iso_checksum_type"`
+	ISOChecksumURL          string   `mapstructure:"iso_checksum_url"`
 	ISOUrls                 []string `mapstructure:"iso_urls"`
 	VMName                  string   `mapstructure:"vm_name"`
 
@@ -61,7 +63,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.config.tpl.UserVars = b.config.PackerUserVars
+	b.config.ConfigureTemplate(b.config.tpl)
 
 	// Accumulate any errors and warnings
 	errs := common.CheckUnusedConfig(md)
@@ -71,6 +73,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	errs = packer.MultiErrorAppend(errs, b.config.RunConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.ShutdownConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.SSHConfig.Prepare(b.config.tpl)...)
+	errs = packer.MultiErrorAppend(errs, b.config.SSHConnectConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.PrlctlConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.PrlctlVersionConfig.Prepare(b.config.tpl)...)
 	warnings := make([]string, 0)
@@ -131,6 +134,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 		"http_directory":             &b.config.HTTPDir,
 		"iso_checksum":               &b.config.ISOChecksum,
 		"iso_checksum_type":          &b.config.ISOChecksumType,
+		"iso_checksum_url":           &b.config.ISOChecksumURL,
 		"iso_url":                    &b.config.RawSingleISOUrl,
 		"vm_name":                    &b.config.VMName,
 	}
@@ -187,9 +191,18 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	} else {
 		b.config.ISOChecksumType = strings.ToLower(b.config.ISOChecksumType)
 		if b.config.ISOChecksumType != "none" {
-			if b.config.ISOChecksum == "" {
+			if b.config.ISOChecksum == "" && b.config.ISOChecksumURL == "" {
 				errs = packer.MultiErrorAppend(
-					errs, errors.New("Due to large file sizes, an iso_checksum is required"))
+					errs, errors.New("Due to large file sizes, an iso_checksum or iso_checksum_url is required"))
+			} else if b.config.ISOChecksum != "" && b.config.ISOChecksumURL != "" {
+				errs = packer.MultiErrorAppend(
+					errs, errors.New("Only one of iso_checksum or iso_checksum_url may be specified."))
+			} else if b.config.ISOChecksumURL != "" {
+				b.config.ISOChecksumURL, err = common.DownloadableURL(b.config.ISOChecksumURL)
+				if err != nil {
+					errs = packer.MultiErrorAppend(
+						errs, fmt.Errorf("Failed to parse iso_checksum_url: %s", err))
+				}
 			} else {
 				b.config.ISOChecksum = strings.ToLower(b.config.ISOChecksum)
 			}
@@ -270,7 +283,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		&common.StepDownload{
 			Checksum:     b.config.ISOChecksum,
 			ChecksumType: b.config.ISOChecksumType,
+			ChecksumURL:  b.config.ISOChecksumURL,
 			Description:  "ISO",
+			Force:        b.config.PackerForce,
 			ResultKey:    "iso_path",
 			Url:          b.config.ISOUrls,
 		},
@@ -306,8 +321,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		},
 		&common.StepConnectSSH{
 			SSHAddress:     parallelscommon.SSHAddress,
-			SSHConfig:      parallelscommon.SSHConfigFunc(b.config.SSHConfig),
+			SSHConfig:      parallelscommon.SSHConfigFunc(b.config.SSHConfig, &b.config.SSHConnectConfig),
 			SSHWaitTimeout: b.config.SSHWaitTimeout,
+			Config:         &b.config.SSHConnectConfig,
 		},
 		&parallelscommon.StepUploadVersion{
 			Path: b.config.PrlctlVersionFile,
@@ -335,14 +351,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	state.Put("ui", ui)
 
 	// Run
-	if b.config.PackerDebug {
-		b.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		b.runner = &multistep.BasicRunner{Steps: steps}
-	}
+	b.runner = common.NewRunner(steps, b.config.PackerConfig, ui)
 
 	b.runner.Run(state)
 
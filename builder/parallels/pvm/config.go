@@ -11,6 +11,7 @@ import (
 // Config is the configuration structure for the builder.
 type Config struct {
 	common.PackerConfig                 `mapstructure:",squash"`
+	common.SSHConnectConfig             `mapstructure:",squash"`
 	parallelscommon.FloppyConfig        `mapstructure:",squash"`
 	parallelscommon.OutputConfig        `mapstructure:",squash"`
 	parallelscommon.RunConfig           `mapstructure:",squash"`
@@ -40,7 +41,7 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	c.tpl.UserVars = c.PackerUserVars
+	c.ConfigureTemplate(c.tpl)
 
 	// Defaults
 	if c.ParallelsToolsMode == "" {
@@ -66,6 +67,7 @@ func NewConfig(raws ...interface{}) (*Config, []string, error) {
 	errs = packer.MultiErrorAppend(errs, c.RunConfig.Prepare(c.tpl)...)
 	errs = packer.MultiErrorAppend(errs, c.ShutdownConfig.Prepare(c.tpl)...)
 	errs = packer.MultiErrorAppend(errs, c.SSHConfig.Prepare(c.tpl)...)
+	errs = packer.MultiErrorAppend(errs, c.SSHConnectConfig.Prepare(c.tpl)...)
 	errs = packer.MultiErrorAppend(errs, c.PrlctlConfig.Prepare(c.tpl)...)
 	errs = packer.MultiErrorAppend(errs, c.PrlctlVersionConfig.Prepare(c.tpl)...)
 
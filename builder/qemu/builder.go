@@ -52,7 +52,8 @@ type Builder struct {
 }
 
 type config struct {
-	common.PackerConfig `mapstructure:",squash"`
+	common.PackerConfig     `mapstructure:",squash"`
+	common.SSHConnectConfig `mapstructure:",squash"`
 
 	Accelerator     string     `mapstructure:"accelerator"`
 	BootCommand     []string   `mapstructure:"boot_command"`
@@ -66,6 +67,7 @@ type config struct {
 	HTTPPortMax     uint       `mapstructure:"http_port_max"`
 	ISOChecksum     string     `mapstructure:"iso_checksum"`
 	ISOChecksumType string     `mapstructure:"iso_checksum_type"`
+	ISOChecksumURL  string     `mapstructure:"iso_checksum_url"`
 	ISOUrls         []string   `mapstructure:"iso_urls"`
 	NetDevice       string     `mapstructure:"net_device"`
 	OutputDir       string     `mapstructure:"output_directory"`
@@ -106,10 +108,11 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.config.tpl.UserVars = b.config.PackerUserVars
+	b.config.ConfigureTemplate(b.config.tpl)
 
 	// Accumulate any errors
 	errs := common.CheckUnusedConfig(md)
+	errs = packer.MultiErrorAppend(errs, b.config.SSHConnectConfig.Prepare(b.config.tpl)...)
 
 	if b.config.DiskSize == 0 {
 		b.config.DiskSize = 40000
@@ -193,6 +196,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 		"http_directory":    &b.config.HTTPDir,
 		"iso_checksum":      &b.config.ISOChecksum,
 		"iso_checksum_type": &b.config.ISOChecksumType,
+		"iso_checksum_url":  &b.config.ISOChecksumURL,
 		"iso_url":           &b.config.RawSingleISOUrl,
 		"output_directory":  &b.config.OutputDir,
 		"shutdown_command":  &b.config.ShutdownCommand,
@@ -269,9 +273,18 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 			errs, errors.New("http_port_min must be less than http_port_max"))
 	}
 
-	if b.config.ISOChecksum == "" {
+	if b.config.ISOChecksum == "" && b.config.ISOChecksumURL == "" {
 		errs = packer.MultiErrorAppend(
-			errs, errors.New("Due to large file sizes, an iso_checksum is required"))
+			errs, errors.New("Due to large file sizes, an iso_checksum or iso_checksum_url is required"))
+	} else if b.config.ISOChecksum != "" && b.config.ISOChecksumURL != "" {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("Only one of iso_checksum or iso_checksum_url may be specified."))
+	} else if b.config.ISOChecksumURL != "" {
+		b.config.ISOChecksumURL, err = common.DownloadableURL(b.config.ISOChecksumURL)
+		if err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Failed to parse iso_checksum_url: %s", err))
+		}
 	} else {
 		b.config.ISOChecksum = strings.ToLower(b.config.ISOChecksum)
 	}
@@ -387,7 +400,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		&common.StepDownload{
 			Checksum:     b.config.ISOChecksum,
 			ChecksumType: b.config.ISOChecksumType,
+			ChecksumURL:  b.config.ISOChecksumURL,
 			Description:  "ISO",
+			Force:        b.config.PackerForce,
 			ResultKey:    "iso_path",
 			Url:          b.config.ISOUrls,
 		},
@@ -409,6 +424,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 			SSHAddress:     sshAddress,
 			SSHConfig:      sshConfig,
 			SSHWaitTimeout: b.config.sshWaitTimeout,
+			Config:         &b.config.SSHConnectConfig,
 		},
 		new(common.StepProvision),
 		new(stepShutdown),
@@ -423,14 +439,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	state.Put("ui", ui)
 
 	// Run
-	if b.config.PackerDebug {
-		b.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		b.runner = &multistep.BasicRunner{Steps: steps}
-	}
+	b.runner = common.NewRunner(steps, b.config.PackerConfig, ui)
 
 	b.runner.Run(state)
 
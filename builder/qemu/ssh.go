@@ -23,13 +23,18 @@ func sshConfig(state multistep.StateBag) (*gossh.ClientConfig, error) {
 			ssh.PasswordKeyboardInteractive(config.SSHPassword)),
 	}
 
+	keys := config.KeyAuth()
 	if config.SSHKeyPath != "" {
 		signer, err := sshKeyToSigner(config.SSHKeyPath)
 		if err != nil {
 			return nil, err
 		}
 
-		auth = append(auth, gossh.PublicKeys(signer))
+		keys.Signers = append(keys.Signers, signer)
+	}
+
+	if !keys.Empty() {
+		auth = append(auth, keys.AuthMethod())
 	}
 
 	return &gossh.ClientConfig{
@@ -4,6 +4,7 @@ import (
 	gossh "code.google.com/p/go.crypto/ssh"
 	"fmt"
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common"
 	"github.com/mitchellh/packer/communicator/ssh"
 	"io/ioutil"
 	"os"
@@ -14,7 +15,7 @@ func SSHAddress(state multistep.StateBag) (string, error) {
 	return fmt.Sprintf("127.0.0.1:%d", sshHostPort), nil
 }
 
-func SSHConfigFunc(config SSHConfig) func(multistep.StateBag) (*gossh.ClientConfig, error) {
+func SSHConfigFunc(config SSHConfig, connConfig *common.SSHConnectConfig) func(multistep.StateBag) (*gossh.ClientConfig, error) {
 	return func(state multistep.StateBag) (*gossh.ClientConfig, error) {
 		auth := []gossh.AuthMethod{
 			gossh.Password(config.SSHPassword),
@@ -22,13 +23,18 @@ func SSHConfigFunc(config SSHConfig) func(multistep.StateBag) (*gossh.ClientConf
 				ssh.PasswordKeyboardInteractive(config.SSHPassword)),
 		}
 
+		keys := connConfig.KeyAuth()
 		if config.SSHKeyPath != "" {
 			signer, err := sshKeyToSigner(config.SSHKeyPath)
 			if err != nil {
 				return nil, err
 			}
 
-			auth = append(auth, gossh.PublicKeys(signer))
+			keys.Signers = append(keys.Signers, signer)
+		}
+
+		if !keys.Empty() {
+			auth = append(auth, keys.AuthMethod())
 		}
 
 		return &gossh.ClientConfig{
@@ -20,6 +20,7 @@ type Builder struct {
 
 type config struct {
 	common.PackerConfig             `mapstructure:",squash"`
+	common.SSHConnectConfig         `mapstructure:",squash"`
 	vboxcommon.ExportConfig         `mapstructure:",squash"`
 	vboxcommon.ExportOpts           `mapstructure:",squash"`
 	vboxcommon.FloppyConfig         `mapstructure:",squash"`
@@ -44,6 +45,7 @@ type config struct {
 	HTTPPortMax          uint     `mapstructure:"http_port_max"`
 	ISOChecksum          string   `mapstructure:"iso_checksum"`
 	ISOChecksumType      string   `mapstructure:"iso_checksum_type"`
+	ISOChecksumURL       string   `mapstructure:"iso_checksum_url"`
 	ISOUrls              []string `mapstructure:"iso_urls"`
 	VMName               string   `mapstructure:"vm_name"`
 
@@ -62,7 +64,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.config.tpl.UserVars = b.config.PackerUserVars
+	b.config.ConfigureTemplate(b.config.tpl)
 
 	// Accumulate any errors and warnings
 	errs := common.CheckUnusedConfig(md)
@@ -74,6 +76,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	errs = packer.MultiErrorAppend(errs, b.config.RunConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.ShutdownConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.SSHConfig.Prepare(b.config.tpl)...)
+	errs = packer.MultiErrorAppend(errs, b.config.SSHConnectConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.VBoxManageConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.VBoxManagePostConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.VBoxVersionConfig.Prepare(b.config.tpl)...)
@@ -120,6 +123,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 		"http_directory":         &b.config.HTTPDir,
 		"iso_checksum":           &b.config.ISOChecksum,
 		"iso_checksum_type":      &b.config.ISOChecksumType,
+		"iso_checksum_url":       &b.config.ISOChecksumURL,
 		"iso_url":                &b.config.RawSingleISOUrl,
 		"vm_name":                &b.config.VMName,
 	}
@@ -177,9 +181,18 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	} else {
 		b.config.ISOChecksumType = strings.ToLower(b.config.ISOChecksumType)
 		if b.config.ISOChecksumType != "none" {
-			if b.config.ISOChecksum == "" {
+			if b.config.ISOChecksum == "" && b.config.ISOChecksumURL == "" {
 				errs = packer.MultiErrorAppend(
-					errs, errors.New("Due to large file sizes, an iso_checksum is required"))
+					errs, errors.New("Due to large file sizes, an iso_checksum or iso_checksum_url is required"))
+			} else if b.config.ISOChecksum != "" && b.config.ISOChecksumURL != "" {
+				errs = packer.MultiErrorAppend(
+					errs, errors.New("Only one of iso_checksum or iso_checksum_url may be specified."))
+			} else if b.config.ISOChecksumURL != "" {
+				b.config.ISOChecksumURL, err = common.DownloadableURL(b.config.ISOChecksumURL)
+				if err != nil {
+					errs = packer.MultiErrorAppend(
+						errs, fmt.Errorf("Failed to parse iso_checksum_url: %s", err))
+				}
 			} else {
 				b.config.ISOChecksum = strings.ToLower(b.config.ISOChecksum)
 			}
@@ -270,7 +283,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		&common.StepDownload{
 			Checksum:     b.config.ISOChecksum,
 			ChecksumType: b.config.ISOChecksumType,
+			ChecksumURL:  b.config.ISOChecksumURL,
 			Description:  "ISO",
+			Force:        b.config.PackerForce,
 			ResultKey:    "iso_path",
 			Url:          b.config.ISOUrls,
 		},
@@ -306,8 +321,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		new(stepTypeBootCommand),
 		&common.StepConnectSSH{
 			SSHAddress:     vboxcommon.SSHAddress,
-			SSHConfig:      vboxcommon.SSHConfigFunc(b.config.SSHConfig),
+			SSHConfig:      vboxcommon.SSHConfigFunc(b.config.SSHConfig, &b.config.SSHConnectConfig),
 			SSHWaitTimeout: b.config.SSHWaitTimeout,
+			Config:         &b.config.SSHConnectConfig,
 		},
 		&vboxcommon.StepUploadVersion{
 			Path: b.config.VBoxVersionFile,
@@ -343,14 +359,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	state.Put("ui", ui)
 
 	// Run
-	if b.config.PackerDebug {
-		b.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		b.runner = &multistep.BasicRunner{Steps: steps}
-	}
+	b.runner = common.NewRunner(steps, b.config.PackerConfig, ui)
 
 	b.runner.Run(state)
 
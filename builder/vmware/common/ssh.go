@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common"
 	"github.com/mitchellh/packer/communicator/ssh"
 )
 
@@ -65,7 +66,7 @@ func SSHAddressFunc(config *SSHConfig) func(multistep.StateBag) (string, error)
 	}
 }
 
-func SSHConfigFunc(config *SSHConfig) func(multistep.StateBag) (*gossh.ClientConfig, error) {
+func SSHConfigFunc(config *SSHConfig, connConfig *common.SSHConnectConfig) func(multistep.StateBag) (*gossh.ClientConfig, error) {
 	return func(state multistep.StateBag) (*gossh.ClientConfig, error) {
 		auth := []gossh.AuthMethod{
 			gossh.Password(config.SSHPassword),
@@ -73,13 +74,18 @@ func SSHConfigFunc(config *SSHConfig) func(multistep.StateBag) (*gossh.ClientCon
 				ssh.PasswordKeyboardInteractive(config.SSHPassword)),
 		}
 
+		keys := connConfig.KeyAuth()
 		if config.SSHKeyPath != "" {
 			signer, err := sshKeyToSigner(config.SSHKeyPath)
 			if err != nil {
 				return nil, err
 			}
 
-			auth = append(auth, gossh.PublicKeys(signer))
+			keys.Signers = append(keys.Signers, signer)
+		}
+
+		if !keys.Empty() {
+			auth = append(auth, keys.AuthMethod())
 		}
 
 		return &gossh.ClientConfig{
@@ -46,9 +46,10 @@ func (s *StepShutdown) Run(state multistep.StateBag) multistep.StepAction {
 
 		var stdout, stderr bytes.Buffer
 		cmd := &packer.RemoteCmd{
-			Command: s.Command,
-			Stdout:  &stdout,
-			Stderr:  &stderr,
+			Command:          s.Command,
+			Stdout:           &stdout,
+			Stderr:           &stderr,
+			ReportDisconnect: true,
 		}
 		if err := comm.Start(cmd); err != nil {
 			err := fmt.Errorf("Failed to send shutdown command: %s", err)
@@ -60,8 +61,12 @@ func (s *StepShutdown) Run(state multistep.StateBag) multistep.StepAction {
 		// Wait for the command to run
 		cmd.Wait()
 
-		// If the command failed to run, notify the user in some way.
-		if cmd.ExitStatus != 0 {
+		// Shutting down usually drops the connection before the command
+		// can report its exit status, which is fine.
+		if cmd.ExitStatus == packer.CmdDisconnect {
+			log.Printf("Shutdown command disconnected, as expected")
+		} else if cmd.ExitStatus != 0 {
+			// If the command failed to run, notify the user in some way.
 			state.Put("error", fmt.Errorf(
 				"Shutdown command has non-zero exit status.\n\nStdout: %s\n\nStderr: %s",
 				stdout.String(), stderr.String()))
@@ -86,6 +86,26 @@ func TestStepShutdown_command(t *testing.T) {
 	}
 }
 
+func TestStepShutdown_commandDisconnect(t *testing.T) {
+	state := testStepShutdownState(t)
+	step := new(StepShutdown)
+	step.Command = "foo"
+	step.Timeout = 10 * time.Second
+	step.Testing = true
+
+	// The connection is lost while shutting down
+	comm := state.Get("communicator").(*packer.MockCommunicator)
+	comm.StartExitStatus = packer.CmdDisconnect
+
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v %s", action, state.Get("error"))
+	}
+
+	if !comm.StartCmd.ReportDisconnect {
+		t.Fatal("should report disconnects")
+	}
+}
+
 func TestStepShutdown_noCommand(t *testing.T) {
 	state := testStepShutdownState(t)
 	step := new(StepShutdown)
@@ -24,6 +24,7 @@ type Builder struct {
 
 type config struct {
 	common.PackerConfig      `mapstructure:",squash"`
+	common.SSHConnectConfig  `mapstructure:",squash"`
 	vmwcommon.DriverConfig   `mapstructure:",squash"`
 	vmwcommon.OutputConfig   `mapstructure:",squash"`
 	vmwcommon.RunConfig      `mapstructure:",squash"`
@@ -39,6 +40,7 @@ type config struct {
 	GuestOSType     string   `mapstructure:"guest_os_type"`
 	ISOChecksum     string   `mapstructure:"iso_checksum"`
 	ISOChecksumType string   `mapstructure:"iso_checksum_type"`
+	ISOChecksumURL  string   `mapstructure:"iso_checksum_url"`
 	ISOUrls         []string `mapstructure:"iso_urls"`
 	VMName          string   `mapstructure:"vm_name"`
 	HTTPDir         string   `mapstructure:"http_directory"`
@@ -72,7 +74,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.config.tpl.UserVars = b.config.PackerUserVars
+	b.config.ConfigureTemplate(b.config.tpl)
 
 	// Accumulate any errors
 	errs := common.CheckUnusedConfig(md)
@@ -82,6 +84,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	errs = packer.MultiErrorAppend(errs, b.config.RunConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.ShutdownConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.SSHConfig.Prepare(b.config.tpl)...)
+	errs = packer.MultiErrorAppend(errs, b.config.SSHConnectConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.ToolsConfig.Prepare(b.config.tpl)...)
 	errs = packer.MultiErrorAppend(errs, b.config.VMXConfig.Prepare(b.config.tpl)...)
 	warnings := make([]string, 0)
@@ -150,6 +153,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 		"http_directory":    &b.config.HTTPDir,
 		"iso_checksum":      &b.config.ISOChecksum,
 		"iso_checksum_type": &b.config.ISOChecksumType,
+		"iso_checksum_url":  &b.config.ISOChecksumURL,
 		"iso_url":           &b.config.RawSingleISOUrl,
 		"vm_name":           &b.config.VMName,
 		"vmx_template_path": &b.config.VMXTemplatePath,
@@ -206,9 +210,18 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	} else {
 		b.config.ISOChecksumType = strings.ToLower(b.config.ISOChecksumType)
 		if b.config.ISOChecksumType != "none" {
-			if b.config.ISOChecksum == "" {
+			if b.config.ISOChecksum == "" && b.config.ISOChecksumURL == "" {
 				errs = packer.MultiErrorAppend(
-					errs, errors.New("Due to large file sizes, an iso_checksum is required"))
+					errs, errors.New("Due to large file sizes, an iso_checksum or iso_checksum_url is required"))
+			} else if b.config.ISOChecksum != "" && b.config.ISOChecksumURL != "" {
+				errs = packer.MultiErrorAppend(
+					errs, errors.New("Only one of iso_checksum or iso_checksum_url may be specified."))
+			} else if b.config.ISOChecksumURL != "" {
+				b.config.ISOChecksumURL, err = common.DownloadableURL(b.config.ISOChecksumURL)
+				if err != nil {
+					errs = packer.MultiErrorAppend(
+						errs, fmt.Errorf("Failed to parse iso_checksum_url: %s", err))
+				}
 			} else {
 				b.config.ISOChecksum = strings.ToLower(b.config.ISOChecksum)
 			}
@@ -316,7 +329,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		&common.StepDownload{
 			Checksum:     b.config.ISOChecksum,
 			ChecksumType: b.config.ISOChecksumType,
+			ChecksumURL:  b.config.ISOChecksumURL,
 			Description:  "ISO",
+			Force:        b.config.PackerForce,
 			ResultKey:    "iso_path",
 			Url:          b.config.ISOUrls,
 		},
@@ -351,9 +366,10 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		&stepTypeBootCommand{},
 		&common.StepConnectSSH{
 			SSHAddress:     driver.SSHAddress,
-			SSHConfig:      vmwcommon.SSHConfigFunc(&b.config.SSHConfig),
+			SSHConfig:      vmwcommon.SSHConfigFunc(&b.config.SSHConfig, &b.config.SSHConnectConfig),
 			SSHWaitTimeout: b.config.SSHWaitTimeout,
 			NoPty:          b.config.SSHSkipRequestPty,
+			Config:         &b.config.SSHConnectConfig,
 		},
 		&vmwcommon.StepUploadTools{
 			RemoteType:        b.config.RemoteType,
@@ -377,14 +393,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	}
 
 	// Run!
-	if b.config.PackerDebug {
-		b.runner = &multistep.DebugRunner{
-			Steps:   steps,
-			PauseFn: common.MultistepDebugFn(ui),
-		}
-	} else {
-		b.runner = &multistep.BasicRunner{Steps: steps}
-	}
+	b.runner = common.NewRunner(steps, b.config.PackerConfig, ui)
 
 	b.runner.Run(state)
 
@@ -59,6 +59,36 @@ func TestBuilderPrepare_ISOChecksum(t *testing.T) {
 	}
 }
 
+func TestBuilderPrepare_ISOChecksumURL(t *testing.T) {
+	var b Builder
+	config := testConfig()
+
+	// Test bad, both are set
+	config["iso_checksum_url"] = "http://example.com/SHA256SUMS"
+	warns, err := b.Prepare(config)
+	if len(warns) > 0 {
+		t.Fatalf("bad: %#v", warns)
+	}
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	// Test good
+	delete(config, "iso_checksum")
+	b = Builder{}
+	warns, err = b.Prepare(config)
+	if len(warns) > 0 {
+		t.Fatalf("bad: %#v", warns)
+	}
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if b.config.ISOChecksumURL != "http://example.com/SHA256SUMS" {
+		t.Fatalf("bad: %s", b.config.ISOChecksumURL)
+	}
+}
+
 func TestBuilderPrepare_ISOChecksumType(t *testing.T) {
 	var b Builder
 	config := testConfig()
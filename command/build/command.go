@@ -23,14 +23,18 @@ func (Command) Help() string {
 func (c Command) Run(env packer.Environment, args []string) int {
 	var cfgDebug bool
 	var cfgForce bool
+	var cfgOnError string
 	var cfgParallel bool
+	var cfgParallelBuilds int
 	buildOptions := new(cmdcommon.BuildOptions)
 
 	cmdFlags := flag.NewFlagSet("build", flag.ContinueOnError)
 	cmdFlags.Usage = func() { env.Ui().Say(c.Help()) }
 	cmdFlags.BoolVar(&cfgDebug, "debug", false, "debug mode for builds")
 	cmdFlags.BoolVar(&cfgForce, "force", false, "force a build if artifacts exist")
+	cmdFlags.StringVar(&cfgOnError, "on-error", packer.OnErrorCleanup, "what to do when a build fails")
 	cmdFlags.BoolVar(&cfgParallel, "parallel", true, "enable/disable parallelization")
+	cmdFlags.IntVar(&cfgParallelBuilds, "parallel-builds", 0, "number of builds to run at once")
 	cmdcommon.BuildOptionFlags(cmdFlags, buildOptions)
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -42,6 +46,23 @@ func (c Command) Run(env packer.Environment, args []string) int {
 		return 1
 	}
 
+	switch cfgOnError {
+	case packer.OnErrorCleanup, packer.OnErrorAbort, packer.OnErrorAsk:
+	default:
+		env.Ui().Error(fmt.Sprintf(
+			"-on-error must be one of: cleanup, abort, ask. Got '%s'", cfgOnError))
+		env.Ui().Error("")
+		env.Ui().Error(c.Help())
+		return 1
+	}
+
+	if cfgParallelBuilds < 0 {
+		env.Ui().Error("-parallel-builds can't be negative")
+		env.Ui().Error("")
+		env.Ui().Error(c.Help())
+		return 1
+	}
+
 	if err := buildOptions.Validate(); err != nil {
 		env.Ui().Error(err.Error())
 		env.Ui().Error("")
@@ -80,8 +101,33 @@ func (c Command) Run(env packer.Environment, args []string) int {
 		return 1
 	}
 
+	// Make sure that the builds that others depend on are being built,
+	// then order the builds so that they come before their dependants.
+	buildNames := make(map[string]bool)
+	for _, b := range builds {
+		buildNames[b.Name()] = true
+	}
+
+	for _, b := range builds {
+		for _, dep := range b.DependsOn() {
+			if !buildNames[dep] {
+				env.Ui().Error(fmt.Sprintf(
+					"Build '%s' depends on build '%s', which isn't being built.",
+					b.Name(), dep))
+				return 1
+			}
+		}
+	}
+
+	builds = orderBuilds(builds)
+
 	if cfgDebug {
 		env.Ui().Say("Debug mode enabled. Builds will not be parallelized.")
+		cfgParallelBuilds = 1
+	}
+
+	if !cfgParallel {
+		cfgParallelBuilds = 1
 	}
 
 	// Compile all the UIs for the builds
@@ -109,17 +155,14 @@ func (c Command) Run(env packer.Environment, args []string) int {
 
 	log.Printf("Build debug mode: %v", cfgDebug)
 	log.Printf("Force build: %v", cfgForce)
+	log.Printf("On error: %s", cfgOnError)
+	log.Printf("Parallel builds: %d", cfgParallelBuilds)
 
-	// Set the debug and force mode and prepare all the builds
-	for _, b := range builds {
+	prepare := func(b packer.Build) error {
 		log.Printf("Preparing build: %s", b.Name())
-		b.SetDebug(cfgDebug)
-		b.SetForce(cfgForce)
-
 		warnings, err := b.Prepare()
 		if err != nil {
-			env.Ui().Error(err.Error())
-			return 1
+			return err
 		}
 		if len(warnings) > 0 {
 			ui := buildUis[b.Name()]
@@ -129,14 +172,126 @@ func (c Command) Run(env packer.Environment, args []string) int {
 			}
 			ui.Say("")
 		}
+
+		return nil
 	}
 
-	// Run all the builds in parallel and wait for them to complete
+	// Set the debug, force and on-error modes and prepare all the builds. Builds
+	// that depend on others are prepared once those are done, since
+	// their configuration can use the artifacts of those builds.
+	for _, b := range builds {
+		b.SetDebug(cfgDebug)
+		b.SetForce(cfgForce)
+		b.SetOnError(cfgOnError)
+
+		if len(b.DependsOn()) > 0 {
+			continue
+		}
+
+		if err := prepare(b); err != nil {
+			env.Ui().Error(err.Error())
+			return 1
+		}
+	}
+
+	// Run the builds in parallel and wait for them to complete. The
+	// results and the interrupted flag are shared by the builds, so they
+	// are only accessed with resultsLock held.
 	var interruptWg, wg sync.WaitGroup
+	var resultsLock sync.Mutex
 	interrupted := false
 	artifacts := make(map[string][]packer.Artifact)
 	errors := make(map[string]error)
+
+	isInterrupted := func() bool {
+		resultsLock.Lock()
+		defer resultsLock.Unlock()
+		return interrupted
+	}
+
+	// Every running build holds a slot, which limits how many builds run
+	// at once. Builds are started in order as slots become free. Without
+	// a limit, there are no slots.
+	var slots chan struct{}
+	if cfgParallelBuilds > 0 {
+		slots = make(chan struct{}, cfgParallelBuilds)
+	}
+
+	// Each build closes its channel when it is done, so that the builds
+	// depending on it can start.
+	done := make(map[string]chan struct{})
 	for _, b := range builds {
+		done[b.Name()] = make(chan struct{})
+	}
+
+	// waitDependencies waits for the dependencies of a build to finish.
+	waitDependencies := func(b packer.Build) {
+		for _, dep := range b.DependsOn() {
+			log.Printf("Build '%s' waiting for build: %s", b.Name(), dep)
+			<-done[dep]
+		}
+	}
+
+	// prepareDependant prepares a build with the artifacts of its
+	// dependencies, once they are done. It returns false if the build
+	// can't run.
+	prepareDependant := func(b packer.Build) bool {
+		name := b.Name()
+		ui := buildUis[name]
+		if isInterrupted() {
+			return false
+		}
+
+		var err error
+		for _, dep := range b.DependsOn() {
+			resultsLock.Lock()
+			depArtifacts, ok := artifacts[dep]
+			resultsLock.Unlock()
+
+			if !ok {
+				ui.Error(fmt.Sprintf("Build '%s' skipped: build '%s' failed.", name, dep))
+				err = fmt.Errorf("Skipped because build '%s' failed.", dep)
+				break
+			}
+
+			b.SetDependencyArtifact(dep, packer.NewBuildArtifact(depArtifacts))
+		}
+
+		if err == nil {
+			if err = prepare(b); err != nil {
+				ui.Error(fmt.Sprintf("Build '%s' errored: %s", name, err))
+			}
+		}
+
+		if err != nil {
+			resultsLock.Lock()
+			errors[name] = err
+			resultsLock.Unlock()
+			return false
+		}
+
+		return true
+	}
+
+	for i, b := range builds {
+		// Builds with dependencies take their slot once the dependencies
+		// are done, so that they don't hold a slot while waiting.
+		if slots != nil && len(b.DependsOn()) == 0 {
+			log.Printf("Waiting for a free slot to start build: %s", b.Name())
+			slots <- struct{}{}
+		}
+
+		if isInterrupted() {
+			log.Println("Interrupted, not going to start any more builds.")
+
+			// Release the builds that are waiting for these
+			for _, b := range builds[i:] {
+				close(done[b.Name()])
+			}
+
+			break
+		}
+
 		// Increment the waitgroup so we wait for this item to finish properly
 		wg.Add(1)
 
@@ -148,7 +303,10 @@ func (c Command) Run(env packer.Environment, args []string) int {
 			<-sigCh
 			interruptWg.Add(1)
 			defer interruptWg.Done()
+
+			resultsLock.Lock()
 			interrupted = true
+			resultsLock.Unlock()
 
 			log.Printf("Stopping build: %s", b.Name())
 			b.Cancel()
@@ -160,10 +318,31 @@ func (c Command) Run(env packer.Environment, args []string) int {
 			defer wg.Done()
 
 			name := b.Name()
+			defer close(done[name])
+
+			if len(b.DependsOn()) > 0 {
+				waitDependencies(b)
+				if slots != nil {
+					log.Printf("Waiting for a free slot to start build: %s", name)
+					slots <- struct{}{}
+				}
+			}
+
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+
+			if len(b.DependsOn()) > 0 && !prepareDependant(b) {
+				return
+			}
+
 			log.Printf("Starting build run: %s", name)
 			ui := buildUis[name]
 			runArtifacts, err := b.Run(ui, env.Cache())
 
+			resultsLock.Lock()
+			defer resultsLock.Unlock()
+
 			if err != nil {
 				ui.Error(fmt.Sprintf("Build '%s' errored: %s", name, err))
 				errors[name] = err
@@ -172,21 +351,6 @@ func (c Command) Run(env packer.Environment, args []string) int {
 				artifacts[name] = runArtifacts
 			}
 		}(b)
-
-		if cfgDebug {
-			log.Printf("Debug enabled, so waiting for build to finish: %s", b.Name())
-			wg.Wait()
-		}
-
-		if !cfgParallel {
-			log.Printf("Parallelization disabled, waiting for build to finish: %s", b.Name())
-			wg.Wait()
-		}
-
-		if interrupted {
-			log.Println("Interrupted, not going to start any more builds.")
-			break
-		}
 	}
 
 	// Wait for both the builds to complete and the interrupt handler,
@@ -197,7 +361,7 @@ func (c Command) Run(env packer.Environment, args []string) int {
 	log.Printf("Builds completed. Waiting on interrupt barrier...")
 	interruptWg.Wait()
 
-	if interrupted {
+	if isInterrupted() {
 		env.Ui().Say("Cleanly cancelled builds after being interrupted.")
 		return 1
 	}
@@ -206,7 +370,13 @@ func (c Command) Run(env packer.Environment, args []string) int {
 		env.Ui().Machine("error-count", strconv.FormatInt(int64(len(errors)), 10))
 
 		env.Ui().Error("\n==> Some builds didn't complete successfully and had errors:")
-		for name, err := range errors {
+		for _, b := range builds {
+			name := b.Name()
+			err, ok := errors[name]
+			if !ok {
+				continue
+			}
+
 			// Create a UI for the machine readable stuff to be targetted
 			ui := &packer.TargettedUi{
 				Target: name,
@@ -221,7 +391,13 @@ func (c Command) Run(env packer.Environment, args []string) int {
 
 	if len(artifacts) > 0 {
 		env.Ui().Say("\n==> Builds finished. The artifacts of successful builds are:")
-		for name, buildArtifacts := range artifacts {
+		for _, b := range builds {
+			name := b.Name()
+			buildArtifacts, ok := artifacts[name]
+			if !ok {
+				continue
+			}
+
 			// Create a UI for the machine readable stuff to be targetted
 			ui := &packer.TargettedUi{
 				Target: name,
@@ -278,3 +454,34 @@ func (c Command) Run(env packer.Environment, args []string) int {
 func (Command) Synopsis() string {
 	return "build image(s) from template"
 }
+
+// orderBuilds orders the builds so that every build comes after the builds
+// that it depends on, keeping the order of the builds otherwise. The
+// template makes sure there are no dependency cycles.
+func orderBuilds(builds []packer.Build) []packer.Build {
+	result := make([]packer.Build, 0, len(builds))
+	placed := make(map[string]bool)
+	for len(result) < len(builds) {
+		for _, b := range builds {
+			if placed[b.Name()] {
+				continue
+			}
+
+			ready := true
+			for _, dep := range b.DependsOn() {
+				if !placed[dep] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				result = append(result, b)
+				placed[b.Name()] = true
+				break
+			}
+		}
+	}
+
+	return result
+}
@@ -3,7 +3,12 @@ package build
 import (
 	"bytes"
 	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func testEnvironment() packer.Environment {
@@ -52,3 +57,165 @@ func TestCommand_Run_MissingFile(t *testing.T) {
 		t.Fatalf("bad: %d", result)
 	}
 }
+
+// concurrentBuilder is a builder that keeps track of how many of its
+// instances run at once.
+type concurrentBuilder struct {
+	l       *sync.Mutex
+	running *int
+	max     *int
+}
+
+func (b *concurrentBuilder) Prepare(...interface{}) ([]string, error) {
+	return nil, nil
+}
+
+func (b *concurrentBuilder) Run(packer.Ui, packer.Hook, packer.Cache) (packer.Artifact, error) {
+	b.l.Lock()
+	*b.running++
+	if *b.running > *b.max {
+		*b.max = *b.running
+	}
+	b.l.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	b.l.Lock()
+	*b.running--
+	b.l.Unlock()
+
+	return nil, nil
+}
+
+func (b *concurrentBuilder) Cancel() {}
+
+func TestCommand_Run_ParallelBuilds(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	tf.Write([]byte(`{
+		"builders": [
+			{"name": "a", "type": "test"},
+			{"name": "b", "type": "test"},
+			{"name": "c", "type": "test"},
+			{"name": "d", "type": "test"}
+		]
+	}`))
+	tf.Close()
+
+	var l sync.Mutex
+	var running, max int
+	config := packer.DefaultEnvironmentConfig()
+	config.Ui = &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+	config.Components.Builder = func(string) (packer.Builder, error) {
+		return &concurrentBuilder{l: &l, running: &running, max: &max}, nil
+	}
+
+	env, err := packer.NewEnvironment(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	command := new(Command)
+	args := []string{"-parallel-builds=2", tf.Name()}
+	if result := command.Run(env, args); result != 0 {
+		t.Fatalf("bad: %d", result)
+	}
+
+	if max != 2 {
+		t.Fatalf("bad: %d", max)
+	}
+}
+
+func TestCommand_Run_ParallelBuildsDependencies(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	// The waiting build "b" must not keep "d" from running next to "a"
+	// and "c"
+	tf.Write([]byte(`{
+		"builders": [
+			{"name": "a", "type": "test"},
+			{"name": "b", "type": "test", "depends_on": ["a"]},
+			{"name": "c", "type": "test"},
+			{"name": "d", "type": "test"}
+		]
+	}`))
+	tf.Close()
+
+	var l sync.Mutex
+	var running, max int
+	config := packer.DefaultEnvironmentConfig()
+	config.Ui = &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+	config.Components.Builder = func(string) (packer.Builder, error) {
+		return &concurrentBuilder{l: &l, running: &running, max: &max}, nil
+	}
+
+	env, err := packer.NewEnvironment(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	command := new(Command)
+	args := []string{"-parallel-builds=3", tf.Name()}
+	if result := command.Run(env, args); result != 0 {
+		t.Fatalf("bad: %d", result)
+	}
+
+	if max != 3 {
+		t.Fatalf("bad: %d", max)
+	}
+}
+
+func TestCommand_Run_ParallelBuildsInvalid(t *testing.T) {
+	command := new(Command)
+	args := []string{"-parallel-builds=-1", "foo.json"}
+	if result := command.Run(testEnvironment(), args); result != 1 {
+		t.Fatalf("bad: %d", result)
+	}
+}
+
+// testBuild is a build that only has a name and dependencies, for
+// testing the order of builds.
+type testBuild struct {
+	packer.Build
+
+	name      string
+	dependsOn []string
+}
+
+func (b *testBuild) Name() string        { return b.name }
+func (b *testBuild) DependsOn() []string { return b.dependsOn }
+
+func TestOrderBuilds(t *testing.T) {
+	builds := []packer.Build{
+		&testBuild{name: "vmx", dependsOn: []string{"iso"}},
+		&testBuild{name: "other"},
+		&testBuild{name: "final", dependsOn: []string{"vmx", "ovf"}},
+		&testBuild{name: "iso"},
+		&testBuild{name: "ovf", dependsOn: []string{"iso"}},
+	}
+
+	ordered := orderBuilds(builds)
+	names := make([]string, len(ordered))
+	for i, b := range ordered {
+		names[i] = b.Name()
+	}
+
+	expected := "other,iso,vmx,ovf,final"
+	if strings.Join(names, ",") != expected {
+		t.Fatalf("bad: %#v", names)
+	}
+}
@@ -12,8 +12,10 @@ Options:
   -force                     Force a build to continue if artifacts exist, deletes existing artifacts
   -machine-readable          Machine-readable output
   -except=foo,bar,baz        Build all builds other than these
+  -on-error=cleanup          What to do when a build fails: cleanup, abort or ask
   -only=foo,bar,baz          Only build the given builds by name
   -parallel=false            Disable parallelization (on by default)
+  -parallel-builds=N         Run at most N builds at once (no limit by default)
   -var 'key=value'           Variable for templates, can be used multiple times.
   -var-file=path             JSON file containing user variables.
 `
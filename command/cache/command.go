@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mitchellh/packer/packer"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Command struct{}
+
+func (Command) Help() string {
+	return strings.TrimSpace(helpText)
+}
+
+func (c Command) Synopsis() string {
+	return "list or prune the download cache"
+}
+
+func (c Command) Run(env packer.Environment, args []string) int {
+	if len(args) == 0 {
+		env.Ui().Error(c.Help())
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		return c.list(env, args[1:])
+	case "prune":
+		return c.prune(env, args[1:])
+	default:
+		env.Ui().Error(fmt.Sprintf("Unknown subcommand: %s", args[0]))
+		env.Ui().Error("")
+		env.Ui().Error(c.Help())
+		return 1
+	}
+}
+
+func (c Command) list(env packer.Environment, args []string) int {
+	flags := flag.NewFlagSet("cache list", flag.ContinueOnError)
+	flags.Usage = func() { env.Ui().Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return 1
+	}
+
+	cache := fileCache()
+	entries, err := cache.Entries()
+	if err != nil {
+		env.Ui().Error(fmt.Sprintf("Error reading cache: %s", err))
+		return 1
+	}
+
+	ui := env.Ui()
+	if len(entries) == 0 {
+		ui.Say(fmt.Sprintf("The cache is empty: %s", cache.CacheDir))
+		return 0
+	}
+
+	var total int64
+	now := time.Now()
+	for _, e := range entries {
+		total += e.Size
+		name := filepath.Base(e.Path)
+		ui.Machine("cache-entry", name,
+			strconv.FormatInt(e.Size, 10),
+			strconv.FormatInt(e.ModTime.Unix(), 10))
+		ui.Say(fmt.Sprintf("%s  %s  %s old",
+			name, formatSize(e.Size), formatAge(now.Sub(e.ModTime))))
+	}
+
+	ui.Say(fmt.Sprintf("\n%d files, %s total", len(entries), formatSize(total)))
+	return 0
+}
+
+func (c Command) prune(env packer.Environment, args []string) int {
+	var rawMaxAge, rawMaxSize string
+
+	flags := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+	flags.Usage = func() { env.Ui().Say(c.Help()) }
+	flags.StringVar(&rawMaxAge, "max-age", "", "")
+	flags.StringVar(&rawMaxSize, "max-size", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 || (rawMaxAge == "" && rawMaxSize == "") {
+		flags.Usage()
+		return 1
+	}
+
+	var maxAge time.Duration
+	if rawMaxAge != "" {
+		var err error
+		maxAge, err = parseAge(rawMaxAge)
+		if err != nil {
+			env.Ui().Error(fmt.Sprintf("Invalid -max-age: %s", err))
+			return 1
+		}
+	}
+
+	var maxSize int64
+	if rawMaxSize != "" {
+		var err error
+		maxSize, err = parseSize(rawMaxSize)
+		if err != nil {
+			env.Ui().Error(fmt.Sprintf("Invalid -max-size: %s", err))
+			return 1
+		}
+	}
+
+	removed, err := fileCache().Prune(maxAge, maxSize)
+	ui := env.Ui()
+	var total int64
+	for _, e := range removed {
+		total += e.Size
+		name := filepath.Base(e.Path)
+		ui.Machine("cache-removed", name, strconv.FormatInt(e.Size, 10))
+		ui.Say(fmt.Sprintf("Removed %s (%s)", name, formatSize(e.Size)))
+	}
+
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error pruning cache: %s", err))
+		return 1
+	}
+
+	ui.Say(fmt.Sprintf("Removed %d files, %s freed", len(removed), formatSize(total)))
+	return 0
+}
+
+// fileCache returns the cache that Packer uses, which is in the directory
+// that the packer binary puts in PACKER_CACHE_DIR.
+func fileCache() *packer.FileCache {
+	cacheDir := os.Getenv("PACKER_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = "packer_cache"
+	}
+
+	return &packer.FileCache{CacheDir: cacheDir}
+}
+
+var sizeUnits = []string{"B", "K", "M", "G", "T"}
+
+// parseSize parses a size in bytes, with an optional K, M, G or T suffix.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+
+	var multiplier int64 = 1
+	for i := len(sizeUnits) - 1; i > 0; i-- {
+		if strings.HasSuffix(s, sizeUnits[i]) {
+			s = strings.TrimSuffix(s, sizeUnits[i])
+			multiplier = 1 << uint(10*i)
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+// parseAge parses a duration like time.ParseDuration, but also accepts a
+// number of days such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+
+		s = fmt.Sprintf("%dh", days*24)
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if d < 0 {
+		return 0, errors.New("can't be negative")
+	}
+
+	return d, nil
+}
+
+func formatSize(n int64) string {
+	size := float64(n)
+	unit := 0
+	for size >= 1024 && unit < len(sizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	return fmt.Sprintf("%.1f %sB", size, sizeUnits[unit])
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
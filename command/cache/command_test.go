@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"bytes"
+	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEnvironment(out *bytes.Buffer) packer.Environment {
+	config := packer.DefaultEnvironmentConfig()
+	config.Ui = &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: out,
+	}
+
+	env, err := packer.NewEnvironment(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return env
+}
+
+func TestCommand_Impl(t *testing.T) {
+	var raw interface{}
+	raw = new(Command)
+	if _, ok := raw.(packer.Command); !ok {
+		t.Fatalf("must be a Command")
+	}
+}
+
+func TestCommand_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := os.Getenv("PACKER_CACHE_DIR")
+	os.Setenv("PACKER_CACHE_DIR", dir)
+	defer os.Setenv("PACKER_CACHE_DIR", old)
+
+	mtime := time.Now().Add(-72 * time.Hour)
+	for _, name := range []string{"old.iso", "new.iso"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, make([]byte, 2048), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if name == "old.iso" {
+			os.Chtimes(path, mtime, mtime)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if code := new(Command).Run(testEnvironment(out), []string{"list"}); code != 0 {
+		t.Fatalf("bad: %d\n%s", code, out)
+	}
+	if !strings.Contains(out.String(), "old.iso  2.0 KB  3 days old") {
+		t.Fatalf("bad: %s", out)
+	}
+
+	out.Reset()
+	args := []string{"prune", "-max-age=2d"}
+	if code := new(Command).Run(testEnvironment(out), args); code != 0 {
+		t.Fatalf("bad: %d\n%s", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.iso")); !os.IsNotExist(err) {
+		t.Fatal("old.iso should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.iso")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Prune needs a limit
+	if code := new(Command).Run(testEnvironment(out), []string{"prune"}); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"100":  100,
+		"2K":   2048,
+		"1.5M": 1536 * 1024,
+		"20G":  20 << 30,
+		"1tb":  1 << 40,
+	}
+
+	for input, expected := range cases {
+		actual, err := parseSize(input)
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		if actual != expected {
+			t.Fatalf("%s: %d", input, actual)
+		}
+	}
+
+	for _, input := range []string{"", "foo", "-1G"} {
+		if _, err := parseSize(input); err == nil {
+			t.Fatalf("%s: should have error", input)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	}
+
+	for input, expected := range cases {
+		actual, err := parseAge(input)
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		if actual != expected {
+			t.Fatalf("%s: %s", input, actual)
+		}
+	}
+
+	if _, err := parseAge("-1h"); err == nil {
+		t.Fatal("should have error")
+	}
+}
@@ -0,0 +1,26 @@
+package cache
+
+const helpText = `
+Usage: packer cache list
+       packer cache prune [options]
+
+  Lists or prunes the files that Packer has downloaded into its cache
+  directory. The cache directory is "packer_cache" in the working directory
+  unless PACKER_CACHE_DIR is set.
+
+  The list subcommand outputs every cached file with its size and the
+  time since it was last used. The prune subcommand removes cached files,
+  skipping those that a running Packer process is using.
+
+Options:
+
+  -machine-readable  Machine-readable output
+
+Options for prune:
+
+  -max-age=720h      Remove files not used for this long. "d" can be used
+                     for days.
+  -max-size=20G      Remove the least recently used files until the cache
+                     is no bigger than this. K, M, G and T suffixes can be
+                     used.
+`
@@ -6,6 +6,7 @@ import (
 	"github.com/mitchellh/packer/packer"
 	"log"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -89,10 +90,15 @@ func (c Command) Run(env packer.Environment, args []string) int {
 				continue
 			}
 
+			def := v.Default
+			if v.Sensitive {
+				def = packer.SensitiveMask
+			}
+
 			padding := strings.Repeat(" ", max-len(k))
-			output := fmt.Sprintf("  %s%s = %s", k, padding, v.Default)
+			output := fmt.Sprintf("  %s%s = %s", k, padding, def)
 
-			ui.Machine("template-variable", k, v.Default, "0")
+			ui.Machine("template-variable", k, def, "0")
 			ui.Say(output)
 		}
 	}
@@ -122,6 +128,9 @@ func (c Command) Run(env packer.Environment, args []string) int {
 			if v.Name != v.Type {
 				output = fmt.Sprintf("%s (%s)", output, v.Type)
 			}
+			if len(v.DependsOn) > 0 {
+				output = fmt.Sprintf("%s depends on: %s", output, strings.Join(v.DependsOn, ", "))
+			}
 
 			ui.Machine("template-builder", k, v.Type)
 			ui.Say(output)
@@ -137,8 +146,27 @@ func (c Command) Run(env packer.Environment, args []string) int {
 		ui.Say("  <No provisioners>")
 	} else {
 		for _, v := range tpl.Provisioners {
-			ui.Machine("template-provisioner", v.Type)
-			ui.Say(fmt.Sprintf("  %s", v.Type))
+			ui.Machine("template-provisioner", v.Type, v.If)
+			ui.Say(fmt.Sprintf("  %s", conditional(v.Type, v.TemplateCondition)))
+		}
+	}
+
+	ui.Say("")
+
+	// Post-processors, one sequence per line
+	ui.Say("Post-processors:\n")
+	if len(tpl.PostProcessors) == 0 {
+		ui.Say("  <No post-processors>")
+	} else {
+		for i, seq := range tpl.PostProcessors {
+			iStr := strconv.FormatInt(int64(i), 10)
+			parts := make([]string, len(seq))
+			for j, v := range seq {
+				ui.Machine("template-post-processor", iStr, v.Type, v.If)
+				parts[j] = conditional(v.Type, v.TemplateCondition)
+			}
+
+			ui.Say(fmt.Sprintf("  %s", strings.Join(parts, " -> ")))
 		}
 	}
 
@@ -148,3 +176,13 @@ func (c Command) Run(env packer.Environment, args []string) int {
 
 	return 0
 }
+
+// conditional adds the condition of a provisioner or post-processor to
+// its type, if it has one.
+func conditional(typ string, c packer.TemplateCondition) string {
+	if c.If == "" {
+		return typ
+	}
+
+	return fmt.Sprintf("%s (if: %s)", typ, c.If)
+}
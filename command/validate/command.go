@@ -81,6 +81,15 @@ func (c Command) Run(env packer.Environment, args []string) int {
 
 	// Check the configuration of all builds
 	for _, b := range builds {
+		// The configuration of builds that depend on others can use the
+		// artifacts of those builds, which don't exist yet.
+		if len(b.DependsOn()) > 0 {
+			warnings[b.Name()] = []string{fmt.Sprintf(
+				"Build depends on builds %s, so it can only be validated "+
+					"when those builds are done.", strings.Join(b.DependsOn(), ", "))}
+			continue
+		}
+
 		log.Printf("Preparing build: %s", b.Name())
 		warns, err := b.Prepare()
 		if len(warns) > 0 {
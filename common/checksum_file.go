@@ -0,0 +1,63 @@
+package common
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// bsdChecksumLine matches lines of checksum files in the BSD format,
+// such as "SHA256 (file.iso) = abc123".
+var bsdChecksumLine = regexp.MustCompile(`^(\w+) \((.+)\) = ([0-9a-fA-F]+)$`)
+
+// gnuChecksumLine matches lines of checksum files in the GNU coreutils
+// format, such as "abc123  file.iso". Files that were checksummed in
+// binary mode have a "*" before the name.
+var gnuChecksumLine = regexp.MustCompile(`^([0-9a-fA-F]+) [ *](.+)$`)
+
+// ParseChecksumFile finds the checksum of the given file in the contents
+// of a checksum file, such as SHA256SUMS, in either the GNU coreutils or
+// the BSD format. Only the base names of the files are compared. Lines
+// that aren't checksums, such as those of a PGP signature, are skipped.
+func ParseChecksumFile(r io.Reader, checksumType string, filename string) (string, error) {
+	filename = path.Base(filename)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		var lineType, name, checksum string
+		if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+			lineType, name, checksum = m[1], m[2], m[3]
+		} else if m := gnuChecksumLine.FindStringSubmatch(line); m != nil {
+			name, checksum = m[2], m[1]
+		} else {
+			continue
+		}
+
+		// BSD files can mix checksum types, so only take the right ones.
+		if lineType != "" && !strings.EqualFold(lineType, checksumType) {
+			continue
+		}
+
+		if path.Base(strings.TrimSpace(name)) != filename {
+			continue
+		}
+
+		if _, err := hex.DecodeString(checksum); err != nil {
+			return "", fmt.Errorf("Invalid checksum for %s: %s", filename, checksum)
+		}
+
+		return strings.ToLower(checksum), nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("No %s checksum found for %s", checksumType, filename)
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+const testChecksumFileGNU = `
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  other.iso
+2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae *ubuntu.iso
+`
+
+const testChecksumFileBSD = `
+MD5 (ubuntu.iso) = acbd18db4cc2f85cedef654fccc4a4d8
+SHA256 (other.iso) = e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
+SHA256 (./ubuntu.iso) = 2C26B46B68FFC68FF99B453C1D30413413422D706483BFA0F98A5E886266E7AE
+`
+
+func TestParseChecksumFile(t *testing.T) {
+	expected := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	for _, data := range []string{testChecksumFileGNU, testChecksumFileBSD} {
+		result, err := ParseChecksumFile(
+			strings.NewReader(data), "sha256", "http://example.com/releases/ubuntu.iso")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if result != expected {
+			t.Fatalf("bad: %s", result)
+		}
+	}
+}
+
+func TestParseChecksumFile_notFound(t *testing.T) {
+	_, err := ParseChecksumFile(
+		strings.NewReader(testChecksumFileGNU), "sha256", "missing.iso")
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	// The BSD file has no MD5 for other.iso
+	_, err = ParseChecksumFile(
+		strings.NewReader(testChecksumFileBSD), "md5", "other.iso")
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	jsonutil "github.com/mitchellh/packer/common/json"
@@ -136,11 +137,29 @@ func readFileVars(path string) (map[string]string, error) {
 		return nil, err
 	}
 
-	vars := make(map[string]string)
-	err = jsonutil.Unmarshal(bytes, &vars)
+	var raw map[string]interface{}
+	err = jsonutil.Unmarshal(bytes, &raw)
 	if err != nil {
 		return nil, err
 	}
 
+	// User variables are passed around as strings, so anything that
+	// isn't a string is encoded as JSON. The template checks that the
+	// values match the types of the variables.
+	vars := make(map[string]string)
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			vars[k] = s
+			continue
+		}
+
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading variable '%s' in %s: %s", k, path, err)
+		}
+
+		vars[k] = string(encoded)
+	}
+
 	return vars, nil
 }
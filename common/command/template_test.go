@@ -2,6 +2,9 @@ package command
 
 import (
 	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"os"
+	"reflect"
 	"testing"
 )
 
@@ -144,3 +147,32 @@ func TestBuildOptionsValidate_userVarFiles(t *testing.T) {
 		t.Fatal("should error")
 	}
 }
+
+func TestBuildOptionsAllUserVars_file(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	tf.Write([]byte(`{"foo": "bar", "list": ["a", "b"], "num": 2}`))
+	tf.Close()
+
+	bf := new(BuildOptions)
+	bf.UserVarFiles = []string{tf.Name()}
+	bf.UserVars = map[string]string{"foo": "baz"}
+
+	vars, err := bf.AllUserVars()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"foo":  "baz",
+		"list": `["a","b"]`,
+		"num":  "2",
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Fatalf("bad: %#v", vars)
+	}
+}
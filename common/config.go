@@ -1,6 +1,7 @@
 package common
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
 	"github.com/mitchellh/packer/packer"
@@ -213,7 +214,7 @@ func decodeConfigHook(raws []interface{}) (mapstructure.DecodeHookFunc, error) {
 	if err != nil {
 		return nil, err
 	}
-	tpl.UserVars = pc.PackerUserVars
+	pc.ConfigureTemplate(tpl)
 
 	return func(f reflect.Kind, t reflect.Kind, v interface{}) (interface{}, error) {
 		if t != reflect.String {
@@ -231,13 +232,38 @@ func decodeConfigHook(raws []interface{}) (mapstructure.DecodeHookFunc, error) {
 
 			if sv, ok := v.(string); ok {
 				var err error
-				v, err = tpl.Process(sv, nil)
+				sv, err = tpl.Process(sv, nil)
 				if err != nil {
 					return nil, err
 				}
+				v = sv
+
+				// List and map user variables are JSON encoded, so
+				// expand them into the structure for list and map fields.
+				if t == reflect.Slice || t == reflect.Map {
+					if structured, ok := decodeStructuredValue(sv); ok {
+						v = structured
+					}
+				}
 			}
 		}
 
 		return v, nil
 	}, nil
 }
+
+// decodeStructuredValue decodes a JSON encoded list or map, returning
+// false if the value isn't one.
+func decodeStructuredValue(v string) (interface{}, bool) {
+	v = strings.TrimSpace(v)
+	if !strings.HasPrefix(v, "[") && !strings.HasPrefix(v, "{") {
+		return nil, false
+	}
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(v), &result); err != nil {
+		return nil, false
+	}
+
+	return result, true
+}
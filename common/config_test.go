@@ -153,6 +153,45 @@ func TestDecodeConfig_userVarConversion(t *testing.T) {
 	}
 }
 
+// This test tests the case that list and map user vars are used for
+// list and map configurations.
+func TestDecodeConfig_userVarStructured(t *testing.T) {
+	type Local struct {
+		List []string
+		Map  map[string]string
+		Str  string
+	}
+
+	raw := map[string]interface{}{
+		"packer_user_variables": map[string]string{
+			"list": `["a","b,c"]`,
+			"map":  `{"foo":"bar"}`,
+		},
+
+		"list": "{{user `list`}}",
+		"map":  "{{user `map`}}",
+		"str":  "{{user `list`}}",
+	}
+
+	var result Local
+	_, err := DecodeConfig(&result, raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(result.List, []string{"a", "b,c"}) {
+		t.Fatalf("invalid: %#v", result.List)
+	}
+
+	if !reflect.DeepEqual(result.Map, map[string]string{"foo": "bar"}) {
+		t.Fatalf("invalid: %#v", result.Map)
+	}
+
+	if result.Str != "{{user `list`}}" {
+		t.Fatalf("invalid: %#v", result.Str)
+	}
+}
+
 // This tests the way MessagePack decodes strings (into []uint8) and
 // that we can still decode into the proper types.
 func TestDecodeConfig_userVarConversionUInt8(t *testing.T) {
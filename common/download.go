@@ -16,6 +16,8 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
 )
 
 // DownloadConfig is the configuration given to instantiate a new
@@ -53,6 +55,9 @@ type DownloadConfig struct {
 type DownloadClient struct {
 	config     *DownloadConfig
 	downloader Downloader
+
+	cancelled bool
+	l         sync.Mutex
 }
 
 // HashForType returns the Hash implementation for the given string
@@ -79,6 +84,7 @@ func NewDownloadClient(c *DownloadConfig) *DownloadClient {
 		c.DownloaderMap = map[string]Downloader{
 			"http":  &HTTPDownloader{userAgent: c.UserAgent},
 			"https": &HTTPDownloader{userAgent: c.UserAgent},
+			"ftp":   &FTPDownloader{},
 		}
 	}
 
@@ -94,8 +100,35 @@ type Downloader interface {
 	Total() uint
 }
 
+// A ResumableDownloader is a Downloader that can continue a download that
+// was interrupted. Resume downloads what is missing from the file and
+// appends it. If the rest can't be downloaded on its own, the file is
+// truncated and downloaded from the start.
+type ResumableDownloader interface {
+	Downloader
+	Resume(*os.File, *url.URL) error
+}
+
+// Cancel cancels the download if it is in progress. The partially
+// downloaded file is kept so that the download can be resumed later.
 func (d *DownloadClient) Cancel() {
-	// TODO(mitchellh): Implement
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	d.cancelled = true
+	if d.downloader != nil {
+		d.downloader.Cancel()
+	}
+}
+
+// ChecksumError is returned by DownloadClient.Get when the downloaded
+// file doesn't match the expected checksum.
+type ChecksumError struct {
+	Expected []byte
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksums didn't match expected: %s", hex.EncodeToString(e.Expected))
 }
 
 func (d *DownloadClient) Get() (string, error) {
@@ -124,22 +157,47 @@ func (d *DownloadClient) Get() (string, error) {
 	} else {
 		finalPath = d.config.TargetPath
 
-		var ok bool
-		d.downloader, ok = d.config.DownloaderMap[url.Scheme]
+		downloader, ok := d.config.DownloaderMap[url.Scheme]
 		if !ok {
 			return "", fmt.Errorf("No downloader for scheme: %s", url.Scheme)
 		}
 
-		// Otherwise, download using the downloader.
-		f, err := os.Create(finalPath)
-		if err != nil {
-			return "", err
+		d.l.Lock()
+		cancelled := d.cancelled
+		d.downloader = downloader
+		d.l.Unlock()
+
+		if cancelled {
+			return "", errors.New("Download cancelled")
+		}
+
+		// Only resume if there is a checksum, since that is the only way
+		// to tell that the pieces of the file fit together.
+		resume := false
+		if _, ok := downloader.(ResumableDownloader); ok && d.config.Hash != nil {
+			if fi, err := os.Stat(finalPath); err == nil && fi.Size() > 0 {
+				resume = true
+			}
+		}
+
+		err = d.download(finalPath, url, resume)
+		if err == nil && resume {
+			// If the resumed file is corrupt, start over once.
+			if verify, _ := d.VerifyChecksum(finalPath); !verify {
+				log.Printf("Resumed download doesn't match checksum, downloading again.")
+				err = d.download(finalPath, url, false)
+			}
 		}
-		defer f.Close()
 
-		log.Printf("Downloading: %s", url.String())
-		err = d.downloader.Download(f, url)
 		if err != nil {
+			d.l.Lock()
+			cancelled := d.cancelled
+			d.l.Unlock()
+
+			if cancelled {
+				return "", errors.New("Download cancelled")
+			}
+
 			return "", err
 		}
 	}
@@ -148,20 +206,53 @@ func (d *DownloadClient) Get() (string, error) {
 		var verify bool
 		verify, err = d.VerifyChecksum(finalPath)
 		if err == nil && !verify {
-			err = fmt.Errorf("checksums didn't match expected: %s", hex.EncodeToString(d.config.Checksum))
+			err = &ChecksumError{Expected: d.config.Checksum}
+
+			// Don't leave a bad download behind to be resumed.
+			if finalPath == d.config.TargetPath {
+				os.Remove(finalPath)
+			}
 		}
 	}
 
 	return finalPath, err
 }
 
+// download downloads the URL into the file at path, continuing what is
+// already in the file if resume is true.
+func (d *DownloadClient) download(path string, url *url.URL, resume bool) error {
+	if resume {
+		f, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		log.Printf("Resuming download: %s", url.String())
+		return d.downloader.(ResumableDownloader).Resume(f, url)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log.Printf("Downloading: %s", url.String())
+	return d.downloader.Download(f, url)
+}
+
 // PercentProgress returns the download progress as a percentage.
 func (d *DownloadClient) PercentProgress() int {
-	if d.downloader == nil {
+	d.l.Lock()
+	downloader := d.downloader
+	d.l.Unlock()
+
+	if downloader == nil || downloader.Total() == 0 {
 		return -1
 	}
 
-	return int((float64(d.downloader.Progress()) / float64(d.downloader.Total())) * 100)
+	return int((float64(downloader.Progress()) / float64(downloader.Total())) * 100)
 }
 
 // VerifyChecksum tests that the path matches the checksum for the
@@ -184,18 +275,50 @@ func (d *DownloadClient) VerifyChecksum(path string) (bool, error) {
 }
 
 // HTTPDownloader is an implementation of Downloader that downloads
-// files over HTTP.
+// files over HTTP. It resumes downloads with Range requests.
 type HTTPDownloader struct {
 	progress  uint
 	total     uint
 	userAgent string
+
+	transport *http.Transport
+	req       *http.Request
+	cancelled bool
+	l         sync.Mutex
 }
 
-func (*HTTPDownloader) Cancel() {
-	// TODO(mitchellh): Implement
+// Cancel aborts the download in progress. If the download hasn't
+// started yet, it is aborted as soon as it starts.
+func (d *HTTPDownloader) Cancel() {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	d.cancelled = true
+	if d.req != nil {
+		d.transport.CancelRequest(d.req)
+	}
 }
 
 func (d *HTTPDownloader) Download(dst io.Writer, src *url.URL) error {
+	return d.download(dst, src, 0)
+}
+
+func (d *HTTPDownloader) Resume(dst *os.File, src *url.URL) error {
+	fi, err := dst.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.Seek(0, os.SEEK_END); err != nil {
+		return err
+	}
+
+	return d.download(dst, src, fi.Size())
+}
+
+// download downloads src to dst, asking for the part of src starting at
+// offset if it isn't zero.
+func (d *HTTPDownloader) download(dst io.Writer, src *url.URL, offset int64) error {
 	log.Printf("Starting download: %s", src.String())
 	req, err := http.NewRequest("GET", src.String(), nil)
 	if err != nil {
@@ -206,18 +329,75 @@ func (d *HTTPDownloader) Download(dst io.Writer, src *url.URL) error {
 		req.Header.Set("User-Agent", d.userAgent)
 	}
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-		},
+	if offset > 0 {
+		log.Printf("Resuming download at byte %d", offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	// Cancelling cancels the request through the transport, which closes
+	// the connection even while the body is being read.
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
 	}
 
+	d.l.Lock()
+	if d.cancelled {
+		d.cancelled = false
+		d.l.Unlock()
+		return errors.New("Download cancelled")
+	}
+	d.transport = transport
+	d.req = req
+	d.l.Unlock()
+
+	defer func() {
+		d.l.Lock()
+		defer d.l.Unlock()
+		d.transport = nil
+		d.req = nil
+		d.cancelled = false
+	}()
+
+	httpClient := &http.Client{Transport: transport}
+
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
-
-	if resp.StatusCode != 200 {
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == 206 && offset > 0:
+		// The server sent the rest of the file, make sure it is the
+		// part we asked for.
+		contentRange := resp.Header.Get("Content-Range")
+		if !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("Unexpected Content-Range when resuming: %s", contentRange)
+		}
+	case resp.StatusCode == 416 && offset > 0:
+		// There is nothing more to download. The checksum decides if
+		// the file is really complete.
+		log.Printf("Range not satisfiable, download already complete")
+		d.l.Lock()
+		d.progress = uint(offset)
+		d.total = uint(offset)
+		d.l.Unlock()
+		return nil
+	case resp.StatusCode == 200:
+		if offset > 0 {
+			// The server doesn't support ranges, so start over.
+			log.Printf("Server doesn't support resuming, downloading everything")
+			f := dst.(*os.File)
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+				return err
+			}
+
+			offset = 0
+		}
+	default:
 		log.Printf(
 			"Non-200 status code: %d. Getting error body.", resp.StatusCode)
 
@@ -227,18 +407,33 @@ func (d *HTTPDownloader) Download(dst io.Writer, src *url.URL) error {
 			resp.StatusCode, errorBody.String())
 	}
 
-	d.progress = 0
-	d.total = uint(resp.ContentLength)
+	d.l.Lock()
+	d.progress = uint(offset)
+	d.total = 0
+	if resp.ContentLength >= 0 {
+		d.total = uint(offset + resp.ContentLength)
+	}
+	d.l.Unlock()
 
 	var buffer [4096]byte
 	for {
 		n, err := resp.Body.Read(buffer[:])
+
+		// The request may have been cancelled before the transport knew
+		// about it, in which case it isn't aborted by CancelRequest.
+		d.l.Lock()
+		cancelled := d.cancelled
+		d.progress += uint(n)
+		d.l.Unlock()
+
+		if cancelled {
+			return errors.New("Download cancelled")
+		}
+
 		if err != nil && err != io.EOF {
 			return err
 		}
 
-		d.progress += uint(n)
-
 		if _, werr := dst.Write(buffer[:n]); werr != nil {
 			return werr
 		}
@@ -252,9 +447,13 @@ func (d *HTTPDownloader) Download(dst io.Writer, src *url.URL) error {
 }
 
 func (d *HTTPDownloader) Progress() uint {
+	d.l.Lock()
+	defer d.l.Unlock()
 	return d.progress
 }
 
 func (d *HTTPDownloader) Total() uint {
+	d.l.Lock()
+	defer d.l.Unlock()
 	return d.total
 }
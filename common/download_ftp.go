@@ -0,0 +1,291 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// pasvResponse matches the address in the response to the PASV command,
+// such as "227 Entering Passive Mode (127,0,0,1,4,1)".
+var pasvResponse = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// FTPDownloader is an implementation of Downloader that downloads files
+// over FTP. It logs in anonymously unless the URL has a user name and
+// password, and resumes downloads with the REST command.
+type FTPDownloader struct {
+	progress uint
+	total    uint
+
+	conns     []net.Conn
+	cancelled bool
+	l         sync.Mutex
+}
+
+// Cancel aborts the download in progress by closing its connections. If
+// the download hasn't started yet, it is aborted as soon as it starts.
+func (d *FTPDownloader) Cancel() {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	if len(d.conns) == 0 {
+		d.cancelled = true
+		return
+	}
+
+	for _, c := range d.conns {
+		c.Close()
+	}
+	d.conns = nil
+}
+
+func (d *FTPDownloader) Download(dst io.Writer, src *url.URL) error {
+	return d.download(dst, src, 0)
+}
+
+func (d *FTPDownloader) Resume(dst *os.File, src *url.URL) error {
+	fi, err := dst.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.Seek(0, os.SEEK_END); err != nil {
+		return err
+	}
+
+	return d.download(dst, src, fi.Size())
+}
+
+func (d *FTPDownloader) Progress() uint {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return d.progress
+}
+
+func (d *FTPDownloader) Total() uint {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return d.total
+}
+
+func (d *FTPDownloader) download(dst io.Writer, src *url.URL, offset int64) error {
+	log.Printf("Starting download: %s", src.String())
+
+	user, password := "anonymous", "anonymous@"
+	if src.User != nil {
+		user = src.User.Username()
+		if p, ok := src.User.Password(); ok {
+			password = p
+		}
+	}
+
+	// The path is relative to the directory we log in to, and each of
+	// its directories is changed to in turn, as described in RFC 1738. A
+	// path starting with an encoded "/" is absolute.
+	dirs := strings.Split(strings.TrimPrefix(src.Path, "/"), "/")
+	name := dirs[len(dirs)-1]
+	dirs = dirs[:len(dirs)-1]
+	if name == "" {
+		return fmt.Errorf("FTP URL doesn't point to a file: %s", src.String())
+	}
+
+	// These are sent as part of commands, so a line break would let
+	// them send commands of their own.
+	for _, arg := range append([]string{user, password, name}, dirs...) {
+		if strings.ContainsAny(arg, "\r\n") {
+			return errors.New("FTP URL can't contain line breaks")
+		}
+	}
+
+	addr := src.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "21")
+	}
+
+	c, err := d.dial(addr)
+	if err != nil {
+		return err
+	}
+	defer d.closeConns()
+
+	conn := textproto.NewConn(c)
+	if _, _, err := conn.ReadResponse(2); err != nil {
+		return err
+	}
+
+	code, _, err := ftpCmd(conn, 0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+
+	switch code {
+	case 230:
+	case 331:
+		if _, _, err := ftpCmd(conn, 2, "PASS %s", password); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("FTP login failed with code %d", code)
+	}
+
+	for i, dir := range dirs {
+		if dir == "" {
+			if i > 0 {
+				continue
+			}
+
+			dir = "/"
+		}
+
+		if _, _, err := ftpCmd(conn, 2, "CWD %s", dir); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err := ftpCmd(conn, 2, "TYPE I"); err != nil {
+		return err
+	}
+
+	// The size is only for progress reporting, so don't fail if the
+	// server doesn't support it.
+	var total uint
+	if _, msg, err := ftpCmd(conn, 213, "SIZE %s", name); err == nil {
+		if size, err := strconv.ParseUint(strings.TrimSpace(msg), 10, 0); err == nil {
+			total = uint(size)
+		}
+	}
+
+	d.l.Lock()
+	d.progress = 0
+	d.total = total
+	d.l.Unlock()
+
+	_, msg, err := ftpCmd(conn, 227, "PASV")
+	if err != nil {
+		return err
+	}
+
+	// Connect to the host that we're already talking to, since the
+	// address in the response is often wrong behind NAT.
+	m := pasvResponse.FindStringSubmatch(msg)
+	if m == nil {
+		return fmt.Errorf("Invalid response to PASV: %s", msg)
+	}
+	p1, _ := strconv.Atoi(m[5])
+	p2, _ := strconv.Atoi(m[6])
+	host, _, _ := net.SplitHostPort(addr)
+
+	data, err := d.dial(net.JoinHostPort(host, strconv.Itoa(p1*256+p2)))
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		if _, _, err := ftpCmd(conn, 3, "REST %d", offset); err != nil {
+			// The server can't resume, so start over.
+			log.Printf("Server doesn't support resuming, downloading everything: %s", err)
+			f := dst.(*os.File)
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+				return err
+			}
+
+			offset = 0
+		}
+	}
+
+	if _, _, err := ftpCmd(conn, 1, "RETR %s", name); err != nil {
+		return err
+	}
+
+	d.l.Lock()
+	d.progress = uint(offset)
+	d.l.Unlock()
+
+	var buffer [4096]byte
+	for {
+		n, err := data.Read(buffer[:])
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		d.l.Lock()
+		d.progress += uint(n)
+		d.l.Unlock()
+
+		if _, werr := dst.Write(buffer[:n]); werr != nil {
+			return werr
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	data.Close()
+	if _, _, err := conn.ReadResponse(2); err != nil {
+		return err
+	}
+
+	ftpCmd(conn, 0, "QUIT")
+	return nil
+}
+
+// dial connects to the address, keeping track of the connection so that
+// Cancel can close it.
+func (d *FTPDownloader) dial(addr string) (net.Conn, error) {
+	d.l.Lock()
+	cancelled := d.cancelled
+	d.cancelled = false
+	d.l.Unlock()
+
+	if cancelled {
+		return nil, errors.New("Download cancelled")
+	}
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.l.Lock()
+	d.conns = append(d.conns, c)
+	d.l.Unlock()
+
+	return c, nil
+}
+
+func (d *FTPDownloader) closeConns() {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	for _, c := range d.conns {
+		c.Close()
+	}
+	d.conns = nil
+}
+
+// ftpCmd sends a command and reads the response, which must have the
+// expected code as understood by textproto.Reader.ReadResponse.
+func ftpCmd(conn *textproto.Conn, expect int, format string, args ...interface{}) (int, string, error) {
+	id, err := conn.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+
+	conn.StartResponse(id)
+	defer conn.EndResponse(id)
+
+	return conn.ReadResponse(expect)
+}
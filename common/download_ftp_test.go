@@ -0,0 +1,367 @@
+package common
+
+import (
+	"bufio"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testFTPServer is a minimal FTP server that serves files from memory.
+// The files are keyed by their path from the login directory, which is
+// "/".
+type testFTPServer struct {
+	Files map[string]string
+
+	listener net.Listener
+	commands []string
+	l        sync.Mutex
+}
+
+func newTestFTPServer(t *testing.T, files map[string]string) *testFTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := &testFTPServer{Files: files, listener: l}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(c)
+		}
+	}()
+
+	return s
+}
+
+func (s *testFTPServer) URL() string {
+	return "ftp://" + s.listener.Addr().String()
+}
+
+func (s *testFTPServer) Close() {
+	s.listener.Close()
+}
+
+func (s *testFTPServer) Commands() []string {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.commands
+}
+
+func (s *testFTPServer) serve(c net.Conn) {
+	defer c.Close()
+
+	var data net.Listener
+	var offset int
+	var cwd string
+	r := bufio.NewReader(c)
+	fmt.Fprintf(c, "220 Ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		s.l.Lock()
+		s.commands = append(s.commands, line)
+		s.l.Unlock()
+
+		parts := strings.SplitN(line, " ", 2)
+		arg := ""
+		if len(parts) > 1 {
+			arg = parts[1]
+		}
+
+		switch parts[0] {
+		case "USER":
+			fmt.Fprintf(c, "331 Password required\r\n")
+		case "PASS":
+			fmt.Fprintf(c, "230 Logged in\r\n")
+		case "CWD":
+			if strings.HasPrefix(arg, "/") {
+				cwd = strings.TrimSuffix(arg, "/")
+			} else {
+				cwd += "/" + arg
+			}
+			fmt.Fprintf(c, "250 Directory changed\r\n")
+		case "TYPE":
+			fmt.Fprintf(c, "200 Type set\r\n")
+		case "SIZE":
+			contents, ok := s.Files[cwd+"/"+arg]
+			if !ok {
+				fmt.Fprintf(c, "550 Not found\r\n")
+				continue
+			}
+			fmt.Fprintf(c, "213 %d\r\n", len(contents))
+		case "PASV":
+			data, err = net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				fmt.Fprintf(c, "425 Can't open data connection\r\n")
+				continue
+			}
+			defer data.Close()
+
+			port := data.Addr().(*net.TCPAddr).Port
+			fmt.Fprintf(c, "227 Entering Passive Mode (127,0,0,1,%d,%d)\r\n", port/256, port%256)
+		case "REST":
+			offset, _ = strconv.Atoi(arg)
+			fmt.Fprintf(c, "350 Restarting\r\n")
+		case "RETR":
+			contents, ok := s.Files[cwd+"/"+arg]
+			if !ok || data == nil {
+				fmt.Fprintf(c, "550 Not found\r\n")
+				continue
+			}
+
+			fmt.Fprintf(c, "150 Opening data connection\r\n")
+			dc, err := data.Accept()
+			if err != nil {
+				return
+			}
+			dc.Write([]byte(contents[offset:]))
+			dc.Close()
+			fmt.Fprintf(c, "226 Transfer complete\r\n")
+		case "QUIT":
+			fmt.Fprintf(c, "221 Bye\r\n")
+			return
+		default:
+			fmt.Fprintf(c, "502 Not implemented\r\n")
+		}
+	}
+}
+
+func TestFTPDownloader_Impl(t *testing.T) {
+	var _ ResumableDownloader = new(FTPDownloader)
+}
+
+func TestFTPDownloader_Download(t *testing.T) {
+	contents := strings.Repeat("packer", 1000)
+	server := newTestFTPServer(t, map[string]string{"/foo.iso": contents})
+	defer server.Close()
+
+	path := testDownloadFile(t, "")
+	defer os.Remove(path)
+
+	config := &DownloadConfig{
+		Url:        server.URL() + "/foo.iso",
+		TargetPath: path,
+	}
+
+	if _, err := NewDownloadClient(config).Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != contents {
+		t.Fatal("bad contents")
+	}
+
+	commands := server.Commands()
+	if len(commands) < 2 || commands[0] != "USER anonymous" {
+		t.Fatalf("bad: %#v", commands)
+	}
+}
+
+func TestFTPDownloader_Download_login(t *testing.T) {
+	server := newTestFTPServer(t, map[string]string{"/foo.iso": "foo"})
+	defer server.Close()
+
+	u, err := url.Parse(server.URL() + "/foo.iso")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	u.User = url.UserPassword("bob", "secret")
+
+	d := new(FTPDownloader)
+	if err := d.Download(ioutil.Discard, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	commands := server.Commands()
+	if len(commands) < 2 || commands[0] != "USER bob" || commands[1] != "PASS secret" {
+		t.Fatalf("bad: %#v", commands)
+	}
+
+	if d.Total() != 3 || d.Progress() != 3 {
+		t.Fatalf("bad: %d %d", d.Progress(), d.Total())
+	}
+}
+
+func TestFTPDownloader_Download_directories(t *testing.T) {
+	server := newTestFTPServer(t, map[string]string{"/pub/images/foo.iso": "foo"})
+	defer server.Close()
+
+	u, err := url.Parse(server.URL() + "/pub/images/foo.iso")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := new(FTPDownloader).Download(ioutil.Discard, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	commands := strings.Join(server.Commands(), "\n")
+	for _, c := range []string{"CWD pub", "CWD images", "SIZE foo.iso", "RETR foo.iso"} {
+		if !strings.Contains(commands, c+"\n") {
+			t.Fatalf("missing %q: %s", c, commands)
+		}
+	}
+}
+
+func TestFTPDownloader_Download_absolute(t *testing.T) {
+	server := newTestFTPServer(t, map[string]string{"/pub/foo.iso": "foo"})
+	defer server.Close()
+
+	u, err := url.Parse(server.URL() + "/%2Fpub/foo.iso")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := new(FTPDownloader).Download(ioutil.Discard, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	commands := strings.Join(server.Commands(), "\n")
+	if !strings.Contains(commands, "CWD /\nCWD pub\n") {
+		t.Fatalf("bad: %s", commands)
+	}
+}
+
+func TestFTPDownloader_Download_lineBreaks(t *testing.T) {
+	server := newTestFTPServer(t, map[string]string{"/foo.iso": "foo"})
+	defer server.Close()
+
+	urls := []string{
+		server.URL() + "/foo.iso%0D%0ADELE%20foo.iso",
+		server.URL() + "/pub%0ADELE%20foo.iso/foo.iso",
+	}
+
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := new(FTPDownloader).Download(ioutil.Discard, u); err == nil {
+			t.Fatalf("should have error: %s", raw)
+		}
+	}
+
+	u, err := url.Parse(server.URL() + "/foo.iso")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	u.User = url.User("bob\r\nDELE foo.iso")
+
+	if err := new(FTPDownloader).Download(ioutil.Discard, u); err == nil {
+		t.Fatal("should have error")
+	}
+
+	if commands := server.Commands(); len(commands) != 0 {
+		t.Fatalf("bad: %#v", commands)
+	}
+}
+
+func TestFTPDownloader_Download_notFound(t *testing.T) {
+	server := newTestFTPServer(t, map[string]string{})
+	defer server.Close()
+
+	u, err := url.Parse(server.URL() + "/foo.iso")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := new(FTPDownloader).Download(ioutil.Discard, u); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestFTPDownloader_Download_progress(t *testing.T) {
+	contents := strings.Repeat("packer", 100000)
+	server := newTestFTPServer(t, map[string]string{"/foo.iso": contents})
+	defer server.Close()
+
+	path := testDownloadFile(t, "")
+	defer os.Remove(path)
+
+	config := &DownloadConfig{
+		Url:        server.URL() + "/foo.iso",
+		TargetPath: path,
+	}
+
+	// Progress is read while downloading, like StepDownload does. Run
+	// with -race to check that this is safe.
+	client := NewDownloadClient(config)
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+				client.PercentProgress()
+			}
+		}
+	}()
+
+	_, err := client.Get()
+	close(stopCh)
+	<-doneCh
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p := client.PercentProgress(); p != 100 {
+		t.Fatalf("bad: %d", p)
+	}
+}
+
+func TestFTPDownloader_Resume(t *testing.T) {
+	contents := strings.Repeat("packer", 1000)
+	server := newTestFTPServer(t, map[string]string{"/foo.iso": contents})
+	defer server.Close()
+
+	path := testDownloadFile(t, contents[:1000])
+	defer os.Remove(path)
+
+	config := &DownloadConfig{
+		Url:        server.URL() + "/foo.iso",
+		TargetPath: path,
+		Hash:       md5.New(),
+		Checksum:   testDownloadChecksum(contents),
+	}
+
+	if _, err := NewDownloadClient(config).Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != contents {
+		t.Fatal("bad contents")
+	}
+
+	found := false
+	for _, c := range server.Commands() {
+		if c == "REST 1000" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("bad: %#v", server.Commands())
+	}
+}
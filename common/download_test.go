@@ -1,13 +1,16 @@
 package common
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDownloadClient_VerifyChecksum(t *testing.T) {
@@ -128,6 +131,193 @@ func TestDownloadClientSetsUserAgent(t *testing.T) {
 	}
 }
 
+// testDownloadFile writes the contents to a temporary file, returning
+// its path.
+func testDownloadFile(t *testing.T, contents string) string {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("tempfile error: %s", err)
+	}
+
+	tf.Write([]byte(contents))
+	tf.Close()
+	return tf.Name()
+}
+
+func testDownloadChecksum(contents string) []byte {
+	h := md5.New()
+	h.Write([]byte(contents))
+	return h.Sum(nil)
+}
+
+func TestDownloadClient_resume(t *testing.T) {
+	contents := strings.Repeat("packer", 1000)
+	path := testDownloadFile(t, contents[:1000])
+	defer os.Remove(path)
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(contents))
+	}))
+	defer server.Close()
+
+	config := &DownloadConfig{
+		Url:        server.URL,
+		TargetPath: path,
+		Hash:       md5.New(),
+		Checksum:   testDownloadChecksum(contents),
+	}
+
+	if _, err := NewDownloadClient(config).Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(ranges) != 1 || ranges[0] != "bytes=1000-" {
+		t.Fatalf("bad: %#v", ranges)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != contents {
+		t.Fatal("bad contents")
+	}
+}
+
+func TestDownloadClient_resumeCorrupt(t *testing.T) {
+	contents := strings.Repeat("packer", 1000)
+	path := testDownloadFile(t, strings.Repeat("x", 1000))
+	defer os.Remove(path)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(contents))
+	}))
+	defer server.Close()
+
+	config := &DownloadConfig{
+		Url:        server.URL,
+		TargetPath: path,
+		Hash:       md5.New(),
+		Checksum:   testDownloadChecksum(contents),
+	}
+
+	if _, err := NewDownloadClient(config).Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != contents {
+		t.Fatal("bad contents")
+	}
+}
+
+func TestDownloadClient_resumeNoRanges(t *testing.T) {
+	contents := strings.Repeat("packer", 1000)
+	path := testDownloadFile(t, contents[:1000])
+	defer os.Remove(path)
+
+	// This server ignores the Range header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(contents))
+	}))
+	defer server.Close()
+
+	config := &DownloadConfig{
+		Url:        server.URL,
+		TargetPath: path,
+		Hash:       md5.New(),
+		Checksum:   testDownloadChecksum(contents),
+	}
+
+	if _, err := NewDownloadClient(config).Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != contents {
+		t.Fatal("bad contents")
+	}
+}
+
+func TestDownloadClient_checksumMismatch(t *testing.T) {
+	path := testDownloadFile(t, "")
+	defer os.Remove(path)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("bar"))
+	}))
+	defer server.Close()
+
+	config := &DownloadConfig{
+		Url:        server.URL,
+		TargetPath: path,
+		Hash:       md5.New(),
+		Checksum:   testDownloadChecksum("foo"),
+	}
+
+	_, err := NewDownloadClient(config).Get()
+	if _, ok := err.(*ChecksumError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("bad download should be removed")
+	}
+}
+
+func TestDownloadClient_cancel(t *testing.T) {
+	path := testDownloadFile(t, "")
+	defer os.Remove(path)
+
+	doneCh := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2000")
+		w.Write(bytes.Repeat([]byte("x"), 1000))
+		w.(http.Flusher).Flush()
+		<-doneCh
+	}))
+	defer server.Close()
+	defer close(doneCh)
+
+	config := &DownloadConfig{
+		Url:        server.URL,
+		TargetPath: path,
+		Hash:       md5.New(),
+		Checksum:   testDownloadChecksum("foo"),
+	}
+
+	client := NewDownloadClient(config)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.Get()
+		errCh <- err
+	}()
+
+	// Wait for the download to start
+	for i := 0; client.PercentProgress() <= 0; i++ {
+		if i > 100 {
+			t.Fatal("download never started")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client.Cancel()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("should have error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download wasn't cancelled")
+	}
+
+	// The partial file is kept to be resumed
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 1000 {
+		t.Fatalf("bad: %#v %s", fi, err)
+	}
+}
+
 func TestHashForType(t *testing.T) {
 	if h := HashForType("md5"); h == nil {
 		t.Fatalf("md5 hash is nil")
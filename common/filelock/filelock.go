@@ -0,0 +1,4 @@
+// Package filelock locks files for other processes using the locks of
+// the operating system, which go away together with the process holding
+// them.
+package filelock
@@ -0,0 +1,45 @@
+package filelock
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	// Two open files stand in for two processes
+	var fs [2]*os.File
+	for i := range fs {
+		fs[i], err = os.OpenFile(tf.Name(), os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer fs[i].Close()
+	}
+
+	if err := Lock(fs[0], false, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := Lock(fs[1], false, false); err != nil {
+		t.Fatalf("should be able to share a read lock: %s", err)
+	}
+	if err := Unlock(fs[1]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := Lock(fs[1], true, false); err == nil {
+		t.Fatal("should not be able to write lock while read locked")
+	}
+
+	// Closing the file releases the lock
+	fs[0].Close()
+	if err := Lock(fs[1], true, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,30 @@
+// +build darwin freebsd linux netbsd openbsd
+
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock locks the file for other processes, either exclusively or
+// shared. If block is false and the lock can't be taken right away, an
+// error is returned. The lock is released when the file is closed, even
+// if the process is killed.
+func Lock(f *os.File, exclusive bool, block bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+
+	return syscall.Flock(int(f.Fd()), how)
+}
+
+// Unlock releases the lock taken with Lock.
+func Unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
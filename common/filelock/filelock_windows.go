@@ -0,0 +1,56 @@
+// +build windows
+
+package filelock
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+)
+
+// Lock locks the file for other processes, either exclusively or
+// shared. If block is false and the lock can't be taken right away, an
+// error is returned. The lock is released when the file is closed, even
+// if the process is killed.
+func Lock(f *os.File, exclusive bool, block bool) error {
+	var flags uint32
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+
+	if !block {
+		flags |= lockfileFailImmediately
+	}
+
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(
+		f.Fd(), uintptr(flags), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// Unlock releases the lock taken with Lock.
+func Unlock(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(
+		f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// This is the key in the state bag that is set when the user chose to
+// abort a failed build without cleaning up.
+const stateAbortCleanup = "packer_abort_cleanup"
+
+// NewRunner returns the multistep.Runner to run the steps of a builder
+// with. It honors the debug mode, and what to do when a step fails as
+// set with the -on-error flag of "packer build".
+func NewRunner(steps []multistep.Step, config PackerConfig, ui packer.Ui) multistep.Runner {
+	switch config.PackerOnError {
+	case packer.OnErrorAbort, packer.OnErrorAsk:
+		wrapped := make([]multistep.Step, len(steps))
+		for i, step := range steps {
+			wrapped[i] = &onErrorStep{
+				Step: step,
+				Mode: config.PackerOnError,
+				Ui:   ui,
+			}
+		}
+
+		steps = wrapped
+	}
+
+	if config.PackerDebug {
+		return &multistep.DebugRunner{
+			Steps:   steps,
+			PauseFn: MultistepDebugFn(ui),
+		}
+	}
+
+	return &multistep.BasicRunner{Steps: steps}
+}
+
+// onErrorStep wraps a step to handle the step failing according to the
+// -on-error mode. Once a build is aborted, none of the steps clean up.
+type onErrorStep struct {
+	Step multistep.Step
+	Mode string
+	Ui   packer.Ui
+}
+
+func (s *onErrorStep) Run(state multistep.StateBag) multistep.StepAction {
+	for {
+		// The error of the step is kept apart so that it doesn't stick
+		// around if the step is retried and succeeds.
+		stepState := &stepErrorState{StateBag: state}
+		action := s.Step.Run(stepState)
+		if action == multistep.ActionContinue {
+			stepState.forwardError()
+			return action
+		}
+
+		choice := packer.OnErrorAbort
+		if _, ok := state.GetOk(multistep.StateCancelled); ok {
+			choice = packer.OnErrorCleanup
+		} else if s.Mode == packer.OnErrorAsk {
+			choice = s.ask(state, stepState.err)
+		}
+
+		switch choice {
+		case "retry":
+			log.Printf("Retrying step: %s", stepName(s.Step))
+			continue
+		case packer.OnErrorAbort:
+			s.Ui.Error("Aborting the build without cleaning up. Anything the " +
+				"build created is left in place and must be removed manually.")
+			state.Put(stateAbortCleanup, true)
+		}
+
+		stepState.forwardError()
+		return action
+	}
+}
+
+func (s *onErrorStep) Cleanup(state multistep.StateBag) {
+	if _, ok := state.GetOk(stateAbortCleanup); ok {
+		log.Printf("Build aborted, not cleaning up step: %s", stepName(s.Step))
+		return
+	}
+
+	s.Step.Cleanup(state)
+}
+
+// ask asks the user what to do about the failed step, returning
+// "retry" or one of the cleanup and abort modes.
+func (s *onErrorStep) ask(state multistep.StateBag, stepErr interface{}) string {
+	message := fmt.Sprintf("Step '%s' failed", stepName(s.Step))
+	if stepErr != nil {
+		message = fmt.Sprintf("%s: %s", message, stepErr)
+	}
+
+	query := fmt.Sprintf(
+		"%s\n[c] Clean up and exit, [a] abort without cleanup, [r] retry step",
+		message)
+
+	for {
+		line, ok := askCancellable(s.Ui, query, state)
+		if !ok {
+			return packer.OnErrorCleanup
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "c", "cleanup":
+			return packer.OnErrorCleanup
+		case "a", "abort":
+			return packer.OnErrorAbort
+		case "r", "retry":
+			return "retry"
+		}
+
+		s.Ui.Error(fmt.Sprintf("Unknown choice '%s'", line))
+	}
+}
+
+// askCancellable asks the user the query, giving up if the build is
+// cancelled or asking fails.
+func askCancellable(ui packer.Ui, query string, state multistep.StateBag) (string, bool) {
+	type answer struct {
+		line string
+		err  error
+	}
+
+	result := make(chan answer, 1)
+	go func() {
+		line, err := ui.Ask(query)
+		result <- answer{line, err}
+	}()
+
+	for {
+		select {
+		case a := <-result:
+			if a.err != nil {
+				log.Printf("Error asking for input: %s", a.err)
+				return "", false
+			}
+
+			return a.line, true
+		case <-time.After(100 * time.Millisecond):
+			if _, ok := state.GetOk(multistep.StateCancelled); ok {
+				return "", false
+			}
+		}
+	}
+}
+
+// stepErrorState is a multistep.StateBag that keeps the "error" that a
+// step puts into it to itself until it is forwarded.
+type stepErrorState struct {
+	multistep.StateBag
+
+	err    interface{}
+	hasErr bool
+}
+
+func (s *stepErrorState) Get(k string) interface{} {
+	v, _ := s.GetOk(k)
+	return v
+}
+
+func (s *stepErrorState) GetOk(k string) (interface{}, bool) {
+	if k == "error" {
+		return s.err, s.hasErr
+	}
+
+	return s.StateBag.GetOk(k)
+}
+
+func (s *stepErrorState) Put(k string, v interface{}) {
+	if k == "error" {
+		s.err = v
+		s.hasErr = true
+		return
+	}
+
+	s.StateBag.Put(k, v)
+}
+
+func (s *stepErrorState) forwardError() {
+	if s.hasErr {
+		s.StateBag.Put("error", s.err)
+	}
+}
+
+func stepName(step multistep.Step) string {
+	return reflect.Indirect(reflect.ValueOf(step)).Type().Name()
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"strings"
+	"testing"
+)
+
+// testStep is a step that fails the first failures times it is run.
+type testStep struct {
+	failures     int
+	runCount     int
+	cleanupCount int
+}
+
+func (s *testStep) Run(state multistep.StateBag) multistep.StepAction {
+	s.runCount++
+	if s.runCount <= s.failures {
+		state.Put("error", errors.New("step failed"))
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *testStep) Cleanup(multistep.StateBag) {
+	s.cleanupCount++
+}
+
+func testRunnerUi(input string) *packer.BasicUi {
+	return &packer.BasicUi{
+		Reader: strings.NewReader(input),
+		Writer: new(bytes.Buffer),
+	}
+}
+
+func TestNewRunner_cleanup(t *testing.T) {
+	first := new(testStep)
+	failing := &testStep{failures: 1}
+	steps := []multistep.Step{first, failing}
+
+	runner := NewRunner(steps, PackerConfig{}, testRunnerUi(""))
+	state := new(multistep.BasicStateBag)
+	runner.Run(state)
+
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+	if first.cleanupCount != 1 || failing.cleanupCount != 1 {
+		t.Fatalf("bad: %d %d", first.cleanupCount, failing.cleanupCount)
+	}
+}
+
+func TestNewRunner_abort(t *testing.T) {
+	first := new(testStep)
+	failing := &testStep{failures: 1}
+	steps := []multistep.Step{first, failing}
+
+	config := PackerConfig{PackerOnError: packer.OnErrorAbort}
+	runner := NewRunner(steps, config, testRunnerUi(""))
+	state := new(multistep.BasicStateBag)
+	runner.Run(state)
+
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+	if first.cleanupCount != 0 || failing.cleanupCount != 0 {
+		t.Fatalf("bad: %d %d", first.cleanupCount, failing.cleanupCount)
+	}
+}
+
+func TestNewRunner_askRetry(t *testing.T) {
+	first := new(testStep)
+	failing := &testStep{failures: 2}
+	steps := []multistep.Step{first, failing}
+
+	config := PackerConfig{PackerOnError: packer.OnErrorAsk}
+	runner := NewRunner(steps, config, testRunnerUi("r\nretry\n"))
+	state := new(multistep.BasicStateBag)
+	runner.Run(state)
+
+	if err, ok := state.GetOk("error"); ok {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if failing.runCount != 3 {
+		t.Fatalf("bad: %d", failing.runCount)
+	}
+	if first.cleanupCount != 1 {
+		t.Fatalf("bad: %d", first.cleanupCount)
+	}
+}
+
+func TestNewRunner_askCleanup(t *testing.T) {
+	first := new(testStep)
+	failing := &testStep{failures: 1}
+	steps := []multistep.Step{first, failing}
+
+	config := PackerConfig{PackerOnError: packer.OnErrorAsk}
+	runner := NewRunner(steps, config, testRunnerUi("nope\nc\n"))
+	state := new(multistep.BasicStateBag)
+	runner.Run(state)
+
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+	if first.cleanupCount != 1 || failing.cleanupCount != 1 {
+		t.Fatalf("bad: %d %d", first.cleanupCount, failing.cleanupCount)
+	}
+}
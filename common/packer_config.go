@@ -1,12 +1,40 @@
 package common
 
+import (
+	"encoding/json"
+	"github.com/mitchellh/packer/packer"
+	"log"
+)
+
 // PackerConfig is a struct that contains the configuration keys that
 // are sent by packer, properly tagged already so mapstructure can load
 // them. Embed this structure into your configuration class to get it.
 type PackerConfig struct {
-	PackerBuildName   string            `mapstructure:"packer_build_name"`
-	PackerBuilderType string            `mapstructure:"packer_builder_type"`
-	PackerDebug       bool              `mapstructure:"packer_debug"`
-	PackerForce       bool              `mapstructure:"packer_force"`
-	PackerUserVars    map[string]string `mapstructure:"packer_user_variables"`
+	PackerBuildArtifacts string            `mapstructure:"packer_build_artifacts"`
+	PackerBuildName      string            `mapstructure:"packer_build_name"`
+	PackerBuilderType    string            `mapstructure:"packer_builder_type"`
+	PackerDebug          bool              `mapstructure:"packer_debug"`
+	PackerForce          bool              `mapstructure:"packer_force"`
+	PackerOnError        string            `mapstructure:"packer_on_error"`
+	PackerTemplatePath   string            `mapstructure:"packer_template_path"`
+	PackerUserVars       map[string]string `mapstructure:"packer_user_variables"`
+}
+
+// ConfigureTemplate sets up the configuration template with the user
+// variables and the information about the build, so that functions such
+// as "user" and "build_name" work.
+func (c *PackerConfig) ConfigureTemplate(tpl *packer.ConfigTemplate) {
+	tpl.UserVars = c.PackerUserVars
+	tpl.BuildName = c.PackerBuildName
+	tpl.BuildType = c.PackerBuilderType
+	tpl.TemplatePath = c.PackerTemplatePath
+
+	if c.PackerBuildArtifacts != "" {
+		// Packer itself encodes these, so this should never fail. If it
+		// does, the "build" function reports the artifacts as missing.
+		err := json.Unmarshal([]byte(c.PackerBuildArtifacts), &tpl.BuildArtifacts)
+		if err != nil {
+			log.Printf("Error decoding build artifacts: %s", err)
+		}
+	}
 }
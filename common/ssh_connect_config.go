@@ -0,0 +1,238 @@
+package common
+
+import (
+	gossh "code.google.com/p/go.crypto/ssh"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/packer/communicator/ssh"
+	"github.com/mitchellh/packer/packer"
+	"net"
+	"os"
+	"time"
+)
+
+// SSHConnectConfig is the configuration for how StepConnectSSH connects
+// and talks to the machine. It is shared by every builder that connects
+// over SSH, so embed it into your builder configuration and pass it to
+// the step.
+type SSHConnectConfig struct {
+	SSHAgentAuth                 bool     `mapstructure:"ssh_agent_auth"`
+	SSHBastionHost               string   `mapstructure:"ssh_bastion_host"`
+	SSHBastionHostKeyFingerprint string   `mapstructure:"ssh_bastion_host_key_fingerprint"`
+	SSHBastionPort               uint     `mapstructure:"ssh_bastion_port"`
+	SSHBastionUsername           string   `mapstructure:"ssh_bastion_username"`
+	SSHBastionPassword           string   `mapstructure:"ssh_bastion_password"`
+	SSHBastionPrivateKeyFile     string   `mapstructure:"ssh_bastion_private_key_file"`
+	SSHFileTransferMethod        string   `mapstructure:"ssh_file_transfer_method"`
+	SSHHostKeyFingerprint        string   `mapstructure:"ssh_host_key_fingerprint"`
+	SSHKnownHostsFile            string   `mapstructure:"ssh_known_hosts_file"`
+	SSHPrivateKeyFiles           []string `mapstructure:"ssh_private_key_files"`
+	RawSSHKeepAliveInterval      string   `mapstructure:"ssh_keep_alive_interval"`
+	RawSSHReconnectTimeout       string   `mapstructure:"ssh_reconnect_timeout"`
+
+	SSHKeepAliveInterval time.Duration
+	SSHReconnectTimeout  time.Duration
+}
+
+func (c *SSHConnectConfig) Prepare(t *packer.ConfigTemplate) []error {
+	if c.SSHBastionPort == 0 {
+		c.SSHBastionPort = 22
+	}
+
+	if c.SSHFileTransferMethod == "" {
+		c.SSHFileTransferMethod = "scp"
+	}
+
+	if c.RawSSHKeepAliveInterval == "" {
+		c.RawSSHKeepAliveInterval = "0"
+	}
+
+	if c.RawSSHReconnectTimeout == "" {
+		c.RawSSHReconnectTimeout = "0"
+	}
+
+	templates := map[string]*string{
+		"ssh_bastion_host":                 &c.SSHBastionHost,
+		"ssh_bastion_host_key_fingerprint": &c.SSHBastionHostKeyFingerprint,
+		"ssh_bastion_username":             &c.SSHBastionUsername,
+		"ssh_bastion_password":             &c.SSHBastionPassword,
+		"ssh_bastion_private_key_file":     &c.SSHBastionPrivateKeyFile,
+		"ssh_file_transfer_method":         &c.SSHFileTransferMethod,
+		"ssh_host_key_fingerprint":         &c.SSHHostKeyFingerprint,
+		"ssh_known_hosts_file":             &c.SSHKnownHostsFile,
+		"ssh_keep_alive_interval":          &c.RawSSHKeepAliveInterval,
+		"ssh_reconnect_timeout":            &c.RawSSHReconnectTimeout,
+	}
+
+	errs := make([]error, 0)
+	for n, ptr := range templates {
+		var err error
+		*ptr, err = t.Process(*ptr, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error processing %s: %s", n, err))
+		}
+	}
+
+	for i, file := range c.SSHPrivateKeyFiles {
+		var err error
+		c.SSHPrivateKeyFiles[i], err = t.Process(file, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(
+				"Error processing ssh_private_key_files[%d]: %s", i, err))
+			continue
+		}
+
+		if _, err := ssh.FileSigner(c.SSHPrivateKeyFiles[i]); err != nil {
+			errs = append(errs, fmt.Errorf("ssh_private_key_files is invalid: %s", err))
+		}
+	}
+
+	if c.SSHAgentAuth && os.Getenv("SSH_AUTH_SOCK") == "" {
+		errs = append(errs, errors.New(
+			"ssh_agent_auth requires an SSH agent, but SSH_AUTH_SOCK is not set"))
+	}
+
+	if c.SSHBastionHost != "" {
+		if c.SSHBastionUsername == "" {
+			errs = append(errs, errors.New(
+				"ssh_bastion_username must be specified with ssh_bastion_host"))
+		}
+
+		if c.SSHBastionPassword == "" && c.SSHBastionPrivateKeyFile == "" && !c.SSHAgentAuth {
+			errs = append(errs, errors.New(
+				"one of ssh_bastion_password, ssh_bastion_private_key_file or ssh_agent_auth must be specified"))
+		}
+
+		if c.SSHBastionPrivateKeyFile != "" {
+			if _, err := ssh.FileSigner(c.SSHBastionPrivateKeyFile); err != nil {
+				errs = append(errs, fmt.Errorf("ssh_bastion_private_key_file is invalid: %s", err))
+			}
+		}
+
+		if c.SSHBastionHostKeyFingerprint != "" {
+			if err := ssh.ValidFingerprint(c.SSHBastionHostKeyFingerprint); err != nil {
+				errs = append(errs, fmt.Errorf("ssh_bastion_host_key_fingerprint is invalid: %s", err))
+			}
+		}
+	}
+
+	if c.SSHHostKeyFingerprint != "" {
+		if err := ssh.ValidFingerprint(c.SSHHostKeyFingerprint); err != nil {
+			errs = append(errs, fmt.Errorf("ssh_host_key_fingerprint is invalid: %s", err))
+		}
+	}
+
+	if c.SSHKnownHostsFile != "" {
+		if _, err := ssh.KnownHostsHostKeyCallback(c.SSHKnownHostsFile); err != nil {
+			errs = append(errs, fmt.Errorf("ssh_known_hosts_file is invalid: %s", err))
+		}
+	}
+
+	var err error
+	c.SSHKeepAliveInterval, err = time.ParseDuration(c.RawSSHKeepAliveInterval)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Failed parsing ssh_keep_alive_interval: %s", err))
+	}
+
+	c.SSHReconnectTimeout, err = time.ParseDuration(c.RawSSHReconnectTimeout)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Failed parsing ssh_reconnect_timeout: %s", err))
+	}
+
+	if c.SSHFileTransferMethod != "scp" && c.SSHFileTransferMethod != "sftp" {
+		errs = append(errs, fmt.Errorf(
+			"ssh_file_transfer_method must be one of: scp, sftp"))
+	}
+
+	return errs
+}
+
+// HasKeyAuth returns true if the SSH agent or any private key files
+// should be used to authenticate.
+func (c *SSHConnectConfig) HasKeyAuth() bool {
+	return c.SSHAgentAuth || len(c.SSHPrivateKeyFiles) > 0
+}
+
+// KeyAuth returns the public keys to authenticate with: the given
+// signers, then the private key files in order, then the keys in the SSH
+// agent if enabled. Builders should use this for their publickey
+// authentication so that all the keys are offered.
+func (c *SSHConnectConfig) KeyAuth(signers ...gossh.Signer) *ssh.KeyAuth {
+	return &ssh.KeyAuth{
+		Agent:   c.SSHAgentAuth,
+		Files:   c.SSHPrivateKeyFiles,
+		Signers: signers,
+	}
+}
+
+// hostKeyCallback returns the callback that verifies the host key of
+// the machine, or nil if any host key is accepted.
+func (c *SSHConnectConfig) hostKeyCallback() (func(string, net.Addr, gossh.PublicKey) error, error) {
+	return c.hostKeyCallbackFor(c.SSHHostKeyFingerprint)
+}
+
+// bastionHostKeyCallback returns the callback that verifies the host key
+// of the bastion host, or nil if any host key is accepted. The known
+// hosts file applies to the bastion as well as the machine.
+func (c *SSHConnectConfig) bastionHostKeyCallback() (func(string, net.Addr, gossh.PublicKey) error, error) {
+	return c.hostKeyCallbackFor(c.SSHBastionHostKeyFingerprint)
+}
+
+func (c *SSHConnectConfig) hostKeyCallbackFor(fingerprint string) (func(string, net.Addr, gossh.PublicKey) error, error) {
+	cbs := make([]func(string, net.Addr, gossh.PublicKey) error, 0, 2)
+	if fingerprint != "" {
+		cbs = append(cbs, ssh.FingerprintHostKeyCallback(fingerprint))
+	}
+
+	if c.SSHKnownHostsFile != "" {
+		cb, err := ssh.KnownHostsHostKeyCallback(c.SSHKnownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cbs = append(cbs, cb)
+	}
+
+	if len(cbs) == 0 {
+		return nil, nil
+	}
+
+	return ssh.MultiHostKeyCallback(cbs...), nil
+}
+
+// bastionAddress returns the address of the bastion host.
+func (c *SSHConnectConfig) bastionAddress() string {
+	return fmt.Sprintf("%s:%d", c.SSHBastionHost, c.SSHBastionPort)
+}
+
+// bastionClientConfig returns the SSH client configuration used to
+// connect to the bastion host.
+func (c *SSHConnectConfig) bastionClientConfig() (*gossh.ClientConfig, error) {
+	auth := make([]gossh.AuthMethod, 0, 3)
+	if c.SSHBastionPassword != "" {
+		auth = append(auth,
+			gossh.Password(c.SSHBastionPassword),
+			gossh.KeyboardInteractive(
+				ssh.PasswordKeyboardInteractive(c.SSHBastionPassword)))
+	}
+
+	if c.SSHBastionPrivateKeyFile != "" || c.SSHAgentAuth {
+		keys := &ssh.KeyAuth{Agent: c.SSHAgentAuth}
+		if c.SSHBastionPrivateKeyFile != "" {
+			keys.Files = []string{c.SSHBastionPrivateKeyFile}
+		}
+
+		auth = append(auth, keys.AuthMethod())
+	}
+
+	hostKeyCallback, err := c.bastionHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &gossh.ClientConfig{
+		User:            c.SSHBastionUsername,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
@@ -0,0 +1,246 @@
+package common
+
+import (
+	"github.com/mitchellh/packer/packer"
+	"os"
+	"testing"
+	"time"
+)
+
+func testSSHConnectConfigTemplate(t *testing.T) *packer.ConfigTemplate {
+	result, err := packer.NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return result
+}
+
+func TestSSHConnectConfigPrepare(t *testing.T) {
+	c := new(SSHConnectConfig)
+	errs := c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	if c.SSHFileTransferMethod != "scp" {
+		t.Fatalf("bad: %s", c.SSHFileTransferMethod)
+	}
+}
+
+func TestSSHConnectConfigPrepare_FileTransferMethod(t *testing.T) {
+	c := &SSHConnectConfig{SSHFileTransferMethod: "sftp"}
+	errs := c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	c = &SSHConnectConfig{SSHFileTransferMethod: "carrier-pigeon"}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+}
+
+func TestSSHConnectConfigPrepare_Bastion(t *testing.T) {
+	c := &SSHConnectConfig{SSHBastionHost: "bastion.example.com"}
+	errs := c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should require bastion credentials")
+	}
+
+	c = &SSHConnectConfig{
+		SSHBastionHost:     "bastion.example.com",
+		SSHBastionUsername: "foo",
+		SSHBastionPassword: "bar",
+	}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	if c.SSHBastionPort != 22 {
+		t.Fatalf("bad: %d", c.SSHBastionPort)
+	}
+
+	if c.bastionAddress() != "bastion.example.com:22" {
+		t.Fatalf("bad: %s", c.bastionAddress())
+	}
+
+	bConf, err := c.bastionClientConfig()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bConf.HostKeyCallback != nil {
+		t.Fatal("should accept any bastion host key by default")
+	}
+
+	c = &SSHConnectConfig{
+		SSHBastionHost:           "bastion.example.com",
+		SSHBastionUsername:       "foo",
+		SSHBastionPrivateKeyFile: "/i/dont/exist",
+	}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+
+	// The bastion host key can be verified
+	c = &SSHConnectConfig{
+		SSHBastionHost:               "bastion.example.com",
+		SSHBastionHostKeyFingerprint: "bad",
+		SSHBastionUsername:           "foo",
+		SSHBastionPassword:           "bar",
+	}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+
+	c.SSHBastionHostKeyFingerprint = "00:11:22:33:44:55:66:77:88:99:aa:bb:cc:dd:ee:ff"
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	bConf, err = c.bastionClientConfig()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bConf.HostKeyCallback == nil {
+		t.Fatal("should verify the bastion host key")
+	}
+
+	// Only the bastion's fingerprint is used for the bastion
+	cb, err := c.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cb != nil {
+		t.Fatal("should accept any host key for the machine")
+	}
+}
+
+func TestSSHConnectConfigPrepare_AgentAuth(t *testing.T) {
+	old := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", old)
+
+	os.Setenv("SSH_AUTH_SOCK", "")
+	c := &SSHConnectConfig{SSHAgentAuth: true}
+	errs := c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+
+	os.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	c = &SSHConnectConfig{SSHAgentAuth: true}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	if !c.HasKeyAuth() {
+		t.Fatal("should have key auth")
+	}
+}
+
+func TestSSHConnectConfigPrepare_PrivateKeyFiles(t *testing.T) {
+	c := &SSHConnectConfig{SSHPrivateKeyFiles: []string{"/i/dont/exist"}}
+	errs := c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+
+	c = new(SSHConnectConfig)
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	if c.HasKeyAuth() {
+		t.Fatal("should not have key auth")
+	}
+}
+
+func TestSSHConnectConfigPrepare_HostKey(t *testing.T) {
+	c := new(SSHConnectConfig)
+	errs := c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	cb, err := c.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cb != nil {
+		t.Fatal("should accept any host key by default")
+	}
+
+	c = &SSHConnectConfig{SSHHostKeyFingerprint: "bad"}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+
+	c = &SSHConnectConfig{
+		SSHHostKeyFingerprint: "00:11:22:33:44:55:66:77:88:99:aa:bb:cc:dd:ee:ff",
+	}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	cb, err = c.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cb == nil {
+		t.Fatal("should verify host key")
+	}
+
+	c = &SSHConnectConfig{SSHKnownHostsFile: "/i/dont/exist"}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+}
+
+func TestSSHConnectConfigPrepare_Reconnect(t *testing.T) {
+	c := new(SSHConnectConfig)
+	errs := c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	if c.SSHKeepAliveInterval != 0 {
+		t.Fatalf("bad: %s", c.SSHKeepAliveInterval)
+	}
+
+	if c.SSHReconnectTimeout != 0 {
+		t.Fatalf("bad: %s", c.SSHReconnectTimeout)
+	}
+
+	c = &SSHConnectConfig{
+		RawSSHKeepAliveInterval: "5s",
+		RawSSHReconnectTimeout:  "10m",
+	}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	if c.SSHKeepAliveInterval != 5*time.Second {
+		t.Fatalf("bad: %s", c.SSHKeepAliveInterval)
+	}
+
+	if c.SSHReconnectTimeout != 10*time.Minute {
+		t.Fatalf("bad: %s", c.SSHReconnectTimeout)
+	}
+
+	c = &SSHConnectConfig{RawSSHReconnectTimeout: "bad"}
+	errs = c.Prepare(testSSHConnectConfigTemplate(t))
+	if len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+}
@@ -37,6 +37,10 @@ type StepConnectSSH struct {
 	// NoPty, if true, will not request a Pty from the remote end.
 	NoPty bool
 
+	// Config is the shared configuration for how to connect and talk
+	// to the machine. If this is nil, the defaults are used.
+	Config *SSHConnectConfig
+
 	comm packer.Communicator
 }
 
@@ -120,8 +124,33 @@ func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan stru
 			continue
 		}
 
-		// Attempt to connect to SSH port
+		// Verify the host key if we were asked to, otherwise any host
+		// key is accepted.
+		if s.Config != nil {
+			hostKeyCallback, err := s.Config.hostKeyCallback()
+			if err != nil {
+				return nil, fmt.Errorf("Error setting up SSH host key verification: %s", err)
+			}
+
+			if hostKeyCallback != nil {
+				sshConfig.HostKeyCallback = hostKeyCallback
+			}
+		}
+
+		// Attempt to connect to SSH port, through the bastion host if
+		// one is configured.
 		connFunc := ssh.ConnectFunc("tcp", address)
+		if s.Config != nil && s.Config.SSHBastionHost != "" {
+			bConf, err := s.Config.bastionClientConfig()
+			if err != nil {
+				return nil, fmt.Errorf("Error setting up SSH bastion host: %s", err)
+			}
+
+			log.Printf("Connecting to %s through bastion %s", address, s.Config.bastionAddress())
+			connFunc = ssh.BastionConnectFunc(
+				"tcp", s.Config.bastionAddress(), bConf, "tcp", address)
+		}
+
 		nc, err := connFunc()
 		if err != nil {
 			log.Printf("TCP connection to SSH ip/port failed: %s", err)
@@ -136,11 +165,23 @@ func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan stru
 			NoPty:      s.NoPty,
 		}
 
+		if s.Config != nil {
+			config.UseSftp = s.Config.SSHFileTransferMethod == "sftp"
+			config.KeepAliveInterval = s.Config.SSHKeepAliveInterval
+			config.ReconnectTimeout = s.Config.SSHReconnectTimeout
+		}
+
 		log.Println("Attempting SSH connection...")
 		comm, err = ssh.New(address, config)
 		if err != nil {
 			log.Printf("SSH handshake err: %s", err)
 
+			// A host key that fails verification won't change by trying
+			// again, so fail right away.
+			if _, ok := err.(*ssh.HostKeyError); ok {
+				return nil, err
+			}
+
 			// Only count this as an attempt if we were able to attempt
 			// to authenticate. Note this is very brittle since it depends
 			// on the string of the error... but I don't see any other way.
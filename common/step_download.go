@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"github.com/mitchellh/multistep"
 	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
 	"log"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -21,10 +25,19 @@ type StepDownload struct {
 	Checksum     string
 	ChecksumType string
 
+	// The URL of a checksum file, such as SHA256SUMS, to get the checksum
+	// from if Checksum is empty. It is looked up by the file name of the
+	// URL that is downloaded.
+	ChecksumURL string
+
 	// A short description of the type of download being done. Example:
 	// "ISO" or "Guest Additions"
 	Description string
 
+	// If true, a file that is already in the cache is downloaded again
+	// instead of being reused.
+	Force bool
+
 	// The name of the key where the final path of the ISO will be put
 	// into the state.
 	ResultKey string
@@ -51,17 +64,68 @@ func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
 		}
 	}
 
+	// A checksum type of "none" means that no checksum is wanted at all.
+	useChecksumURL := s.Checksum == "" && s.ChecksumURL != "" && s.ChecksumType != "none"
+
+	var checksumFile string
+	if useChecksumURL {
+		ui.Say(fmt.Sprintf("Downloading checksum file for %s: %s", s.Description, s.ChecksumURL))
+
+		var err error
+		checksumFile, err = s.downloadChecksumFile()
+		if err != nil {
+			err := fmt.Errorf("Error downloading checksum file: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
 	ui.Say(fmt.Sprintf("Downloading or copying %s", s.Description))
 
+	// Every mirror that fails is recorded, so that the final error says
+	// why each one of them couldn't be used.
+	var errs *packer.MultiError
+
+	// The cached files removed because of Force, so that a file isn't
+	// removed again when the next mirror is tried.
+	forced := make(map[string]bool)
+
 	var finalPath string
 	for _, url := range s.Url {
 		ui.Message(fmt.Sprintf("Downloading or copying: %s", url))
 
+		if useChecksumURL {
+			var err error
+			checksum, err = s.checksumFromFile(checksumFile, url)
+			if err != nil {
+				ui.Message(fmt.Sprintf("Error finding checksum: %s", err))
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("%s: %s", url, err))
+				continue
+			}
+		}
+
+		// Files with a checksum are cached by the checksum, so that a
+		// file is reused no matter which URL it was downloaded from.
+		cacheKey := url
+		if len(checksum) > 0 && s.ChecksumType != "none" {
+			cacheKey = packer.ChecksumKey(
+				s.ChecksumType, hex.EncodeToString(checksum), url)
+		}
+
 		targetPath := s.TargetPath
 		if targetPath == "" {
 			log.Printf("Acquiring lock to download: %s", url)
-			targetPath = cache.Lock(url)
-			defer cache.Unlock(url)
+			targetPath = cache.Lock(cacheKey)
+
+			if s.Force && !forced[targetPath] {
+				log.Printf("Force enabled, removing cached file: %s", targetPath)
+				if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+					log.Printf("Error removing cached file: %s", err)
+				}
+
+				forced[targetPath] = true
+			}
 		}
 
 		config := &DownloadConfig{
@@ -74,8 +138,8 @@ func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
 		}
 
 		path, err, retry := s.download(config, state)
-		if err != nil {
-			ui.Message(fmt.Sprintf("Error downloading: %s", err))
+		if s.TargetPath == "" {
+			cache.Unlock(cacheKey)
 		}
 
 		if !retry {
@@ -86,10 +150,22 @@ func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
 			finalPath = path
 			break
 		}
+
+		if _, ok := err.(*ChecksumError); ok {
+			ui.Message(fmt.Sprintf("Mirror has a file with the wrong checksum, skipping: %s", url))
+		} else {
+			ui.Message(fmt.Sprintf("Error downloading: %s", err))
+		}
+
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("%s: %s", url, err))
 	}
 
 	if finalPath == "" {
 		err := fmt.Errorf("%s download failed.", s.Description)
+		if errs != nil {
+			err = fmt.Errorf("%s download failed from every URL. %s", s.Description, errs)
+		}
+
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
@@ -101,6 +177,53 @@ func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
 
 func (s *StepDownload) Cleanup(multistep.StateBag) {}
 
+// downloadChecksumFile downloads the checksum file, returning its
+// contents.
+func (s *StepDownload) downloadChecksumFile() (string, error) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		return "", err
+	}
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	config := &DownloadConfig{
+		Url:        s.ChecksumURL,
+		TargetPath: tf.Name(),
+		UserAgent:  packer.VersionString(),
+	}
+
+	path, err := NewDownloadClient(config).Get()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// checksumFromFile finds the checksum of the file that the URL points to
+// in the contents of the checksum file.
+func (s *StepDownload) checksumFromFile(contents string, rawUrl string) ([]byte, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := ParseChecksumFile(
+		strings.NewReader(contents), s.ChecksumType, u.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Checksum of %s from checksum file: %s", rawUrl, checksum)
+	return hex.DecodeString(checksum)
+}
+
 func (s *StepDownload) download(config *DownloadConfig, state multistep.StateBag) (string, error, bool) {
 	var path string
 	ui := state.Get("ui").(packer.Ui)
@@ -132,6 +255,12 @@ func (s *StepDownload) download(config *DownloadConfig, state multistep.StateBag
 		case <-time.After(1 * time.Second):
 			if _, ok := state.GetOk(multistep.StateCancelled); ok {
 				ui.Say("Interrupt received. Cancelling download...")
+				download.Cancel()
+
+				// Wait for the download to stop, so that the file is
+				// closed before the cache lock is released. What was
+				// downloaded so far is kept to be resumed next time.
+				<-downloadCompleteCh
 				return "", nil, false
 			}
 		}
@@ -1,7 +1,15 @@
 package common
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -12,3 +20,171 @@ func TestStepDownload_Impl(t *testing.T) {
 		t.Fatalf("download should be a step")
 	}
 }
+
+func testStepDownloadState(t *testing.T) (multistep.StateBag, string) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("cache", &packer.FileCache{CacheDir: dir})
+	state.Put("ui", &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	})
+	return state, dir
+}
+
+func TestStepDownload_checksumURL(t *testing.T) {
+	// md5 of "foo"
+	sums := "acbd18db4cc2f85cedef654fccc4a4d8  foo.iso\n" +
+		"37b51d194a7513e45b56f6524f2d51f2  bar.iso\n"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/MD5SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sums)
+	})
+	mux.HandleFunc("/foo.iso", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "foo")
+	})
+	mux.HandleFunc("/bar.iso", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "not bar")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	state, dir := testStepDownloadState(t)
+	defer os.RemoveAll(dir)
+
+	step := &StepDownload{
+		ChecksumType: "md5",
+		ChecksumURL:  server.URL + "/MD5SUMS",
+		Description:  "ISO",
+		ResultKey:    "iso_path",
+		Url:          []string{server.URL + "/foo.iso"},
+	}
+
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad: %#v %s", action, state.Get("error"))
+	}
+
+	data, err := ioutil.ReadFile(state.Get("iso_path").(string))
+	if err != nil || string(data) != "foo" {
+		t.Fatalf("bad: %s %s", data, err)
+	}
+
+	// A file that doesn't match the checksum in the file fails
+	state, dir = testStepDownloadState(t)
+	defer os.RemoveAll(dir)
+
+	step.Url = []string{server.URL + "/bar.iso"}
+	if action := step.Run(state); action != multistep.ActionHalt {
+		t.Fatalf("bad: %#v", action)
+	}
+}
+
+func TestStepDownload_mirrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bad.iso", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "bar")
+	})
+	mux.HandleFunc("/good.iso", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "foo")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	state, dir := testStepDownloadState(t)
+	defer os.RemoveAll(dir)
+
+	// md5 of "foo"
+	step := &StepDownload{
+		Checksum:     "acbd18db4cc2f85cedef654fccc4a4d8",
+		ChecksumType: "md5",
+		Description:  "ISO",
+		ResultKey:    "iso_path",
+		Url: []string{
+			server.URL + "/missing.iso",
+			server.URL + "/bad.iso",
+			server.URL + "/good.iso",
+		},
+	}
+
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad: %#v %s", action, state.Get("error"))
+	}
+
+	data, err := ioutil.ReadFile(state.Get("iso_path").(string))
+	if err != nil || string(data) != "foo" {
+		t.Fatalf("bad: %s %s", data, err)
+	}
+
+	// Without a good mirror, every failure is in the error
+	state, dir = testStepDownloadState(t)
+	defer os.RemoveAll(dir)
+
+	step.Url = step.Url[:2]
+	if action := step.Run(state); action != multistep.ActionHalt {
+		t.Fatalf("bad: %#v", action)
+	}
+
+	err = state.Get("error").(error)
+	for _, u := range step.Url {
+		if !strings.Contains(err.Error(), u) {
+			t.Fatalf("error should mention %s: %s", u, err)
+		}
+	}
+	if !strings.Contains(err.Error(), "checksums didn't match") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestStepDownload_cacheByChecksum(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprint(w, "foo")
+	}))
+	defer server.Close()
+
+	state, dir := testStepDownloadState(t)
+	defer os.RemoveAll(dir)
+
+	// md5 of "foo"
+	step := &StepDownload{
+		Checksum:     "acbd18db4cc2f85cedef654fccc4a4d8",
+		ChecksumType: "md5",
+		Description:  "ISO",
+		ResultKey:    "iso_path",
+		Url:          []string{server.URL + "/mirror1/foo.iso"},
+	}
+
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad: %#v %s", action, state.Get("error"))
+	}
+	path := state.Get("iso_path").(string)
+
+	// The same file from another URL comes from the cache
+	step.Url = []string{server.URL + "/mirror2/foo.iso"}
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad: %#v %s", action, state.Get("error"))
+	}
+
+	if hits != 1 {
+		t.Fatalf("bad: %d", hits)
+	}
+	if state.Get("iso_path").(string) != path {
+		t.Fatalf("bad: %s", state.Get("iso_path"))
+	}
+
+	// Force downloads it again
+	step.Force = true
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad: %#v %s", action, state.Get("error"))
+	}
+
+	if hits != 2 {
+		t.Fatalf("bad: %d", hits)
+	}
+}
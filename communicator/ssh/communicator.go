@@ -13,14 +13,24 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// reconnectInterval is how long to wait between attempts to reconnect.
+var reconnectInterval = 5 * time.Second
+
 type comm struct {
 	client  *ssh.Client
 	config  *Config
 	conn    net.Conn
 	address string
+
+	// lock is held while opening sessions so that only one reconnect
+	// happens at a time.
+	lock sync.Mutex
 }
 
 // Config is the structure used to configure the SSH communicator.
@@ -35,6 +45,20 @@ type Config struct {
 
 	// NoPty, if true, will not request a pty from the remote end.
 	NoPty bool
+
+	// UseSftp, if true, transfers files with the SFTP subsystem instead
+	// of running scp on the remote end.
+	UseSftp bool
+
+	// KeepAliveInterval is how often to send keepalive requests to the
+	// remote end, so that a dead connection is noticed. Zero disables
+	// keepalives.
+	KeepAliveInterval time.Duration
+
+	// ReconnectTimeout is how long to keep trying to reconnect when the
+	// connection is lost, such as when the machine reboots. With zero,
+	// reconnecting is only attempted once.
+	ReconnectTimeout time.Duration
 }
 
 // Creates a new packer.Communicator implementation over SSH. This takes
@@ -84,6 +108,13 @@ func (c *comm) Start(cmd *packer.RemoteCmd) (err error) {
 		return
 	}
 
+	// Aborting kills the command if the server supports signals, and
+	// closes the session either way.
+	cmd.SetAbort(func() {
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+	})
+
 	// A channel to keep track of our done state
 	doneCh := make(chan struct{})
 	sessionLock := new(sync.Mutex)
@@ -100,6 +131,13 @@ func (c *comm) Start(cmd *packer.RemoteCmd) (err error) {
 			exitErr, ok := err.(*ssh.ExitError)
 			if ok {
 				exitStatus = exitErr.ExitStatus()
+			} else {
+				// The session ended without an exit status, which means
+				// the connection went away while the command was running.
+				log.Printf("remote command ended without exit status: %s", err)
+				if cmd.ReportDisconnect {
+					exitStatus = packer.CmdDisconnect
+				}
 			}
 		}
 
@@ -120,6 +158,10 @@ func (c *comm) Start(cmd *packer.RemoteCmd) (err error) {
 }
 
 func (c *comm) Upload(path string, input io.Reader) error {
+	if c.config.UseSftp {
+		return c.sftpUpload(path, input)
+	}
+
 	// The target directory and file for talking the SCP protocol
 	target_dir := filepath.Dir(path)
 	target_file := filepath.Base(path)
@@ -138,6 +180,10 @@ func (c *comm) Upload(path string, input io.Reader) error {
 
 func (c *comm) UploadDir(dst string, src string, excl []string) error {
 	log.Printf("Upload dir '%s' to '%s'", src, dst)
+	if c.config.UseSftp {
+		return c.sftpUploadDir(dst, src, excl)
+	}
+
 	scpFunc := func(w io.Writer, r *bufio.Reader) error {
 		uploadEntries := func() error {
 			f, err := os.Open(src)
@@ -166,11 +212,38 @@ func (c *comm) UploadDir(dst string, src string, excl []string) error {
 	return c.scpSession("scp -rvt "+dst, scpFunc)
 }
 
-func (c *comm) Download(string, io.Writer) error {
-	panic("not implemented yet")
+func (c *comm) Download(path string, output io.Writer) error {
+	if c.config.UseSftp {
+		return c.sftpDownload(path, output)
+	}
+
+	scpFunc := func(w io.Writer, stdoutR *bufio.Reader) error {
+		return scpDownloadFile(output, w, stdoutR)
+	}
+
+	return c.scpSession("scp -vf "+filepath.ToSlash(path), scpFunc)
+}
+
+func (c *comm) DownloadDir(src string, dst string, excl []string) error {
+	log.Printf("Download dir '%s' to '%s'", src, dst)
+	if c.config.UseSftp {
+		return c.sftpDownloadDir(src, dst, excl)
+	}
+
+	scpFunc := func(w io.Writer, r *bufio.Reader) error {
+		// With a trailing slash only the contents of the directory are
+		// downloaded, so the top-level directory maps directly to dst.
+		contentsOnly := src[len(src)-1] == '/'
+		return scpDownloadDir(dst, contentsOnly, excl, w, r)
+	}
+
+	return c.scpSession("scp -rvf "+filepath.ToSlash(src), scpFunc)
 }
 
 func (c *comm) newSession() (session *ssh.Session, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	log.Println("opening new ssh session")
 	if c.client == nil {
 		err = errors.New("client not available")
@@ -178,16 +251,32 @@ func (c *comm) newSession() (session *ssh.Session, err error) {
 		session, err = c.client.NewSession()
 	}
 
-	if err != nil {
-		log.Printf("ssh session open error: '%s', attempting reconnect", err)
-		if err := c.reconnect(); err != nil {
+	if err == nil {
+		return session, nil
+	}
+
+	log.Printf("ssh session open error: '%s', attempting reconnect", err)
+	deadline := time.Now().Add(c.config.ReconnectTimeout)
+	for {
+		if err = c.reconnect(); err == nil {
+			session, err = c.client.NewSession()
+			if err == nil {
+				return session, nil
+			}
+		}
+
+		// A bad host key won't get better by retrying
+		if _, ok := err.(*HostKeyError); ok {
 			return nil, err
 		}
 
-		return c.client.NewSession()
-	}
+		if time.Now().Add(reconnectInterval).After(deadline) {
+			return nil, err
+		}
 
-	return session, nil
+		log.Printf("reconnect failed, retrying in %s: %s", reconnectInterval, err)
+		time.Sleep(reconnectInterval)
+	}
 }
 
 func (c *comm) reconnect() (err error) {
@@ -214,18 +303,67 @@ func (c *comm) reconnect() (err error) {
 		return
 	}
 
+	// Keep track of host key verification failures so they can be
+	// reported as such, rather than as a generic handshake error.
+	sshConfig := c.config.SSHConfig
+	var hostKeyErr error
+	if verify := sshConfig.HostKeyCallback; verify != nil {
+		config := *sshConfig
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKeyErr = verify(hostname, remote, key)
+			return hostKeyErr
+		}
+		sshConfig = &config
+	}
+
 	log.Printf("handshaking with SSH")
-	sshConn, sshChan, req, err := ssh.NewClientConn(c.conn, c.address, c.config.SSHConfig)
+	sshConn, sshChan, req, err := ssh.NewClientConn(c.conn, c.address, sshConfig)
 	if err != nil {
 		log.Printf("handshake error: %s", err)
+		if hostKeyErr != nil {
+			err = hostKeyErr
+		}
 	}
 	if sshConn != nil {
 		c.client = ssh.NewClient(sshConn, sshChan, req)
 	}
 
+	if err == nil && c.config.KeepAliveInterval > 0 {
+		go keepAlive(c.client, c.conn, c.config.KeepAliveInterval)
+	}
+
 	return
 }
 
+// keepAlive sends keepalive requests over the client until one fails or
+// isn't answered within a few intervals, at which point the connection is
+// closed. This makes commands running over a dead connection fail rather
+// than hang, and the next session will reconnect.
+func keepAlive(client *ssh.Client, conn net.Conn, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			errCh <- err
+		}()
+
+		var err error
+		select {
+		case err = <-errCh:
+		case <-time.After(3 * interval):
+			err = errors.New("no response")
+		}
+
+		if err != nil {
+			log.Printf("keepalive failed, closing connection: %s", err)
+			conn.Close()
+			return
+		}
+	}
+}
+
 func (c *comm) scpSession(scpCommand string, f func(io.Writer, *bufio.Reader) error) error {
 	session, err := c.newSession()
 	if err != nil {
@@ -328,6 +466,217 @@ func checkSCPStatus(r *bufio.Reader) error {
 	return nil
 }
 
+// scpHeader is a single control message sent by the source side of the
+// SCP protocol.
+type scpHeader struct {
+	// Kind is 'C' for a file, 'D' to enter a directory and 'E' to
+	// leave the current directory.
+	Kind byte
+	Mode os.FileMode
+	Size int64
+	Name string
+}
+
+// readSCPHeader reads the next control message from the source side of
+// an SCP session. Error messages sent by the remote side are returned as
+// errors.
+func readSCPHeader(r *bufio.Reader) (*scpHeader, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\n")
+
+	switch code {
+	case 'C', 'D':
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Bad SCP header: %q", string(code)+line)
+		}
+
+		mode, err := strconv.ParseUint(parts[0], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Bad SCP file mode %q: %s", parts[0], err)
+		}
+
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad SCP file size %q: %s", parts[1], err)
+		}
+
+		// The name is joined to a local path, so it must not be able to
+		// point anywhere but into the directory being downloaded to.
+		name := parts[2]
+		if name == "" || name == "." || name == ".." ||
+			strings.ContainsRune(name, '/') ||
+			strings.ContainsRune(name, filepath.Separator) {
+			return nil, fmt.Errorf("Bad SCP file name: %q", name)
+		}
+
+		return &scpHeader{
+			Kind: code,
+			Mode: os.FileMode(mode),
+			Size: size,
+			Name: name,
+		}, nil
+	case 'E':
+		return &scpHeader{Kind: code}, nil
+	case 1, 2:
+		return nil, errors.New(line)
+	default:
+		return nil, fmt.Errorf("Unexpected SCP message: %q", string(code)+line)
+	}
+}
+
+// scpDownloadFileData reads the contents of a file announced by the
+// given header, copying them to dst.
+func scpDownloadFileData(h *scpHeader, dst io.Writer, w io.Writer, r *bufio.Reader) error {
+	// Acknowledge the header, which starts the data transfer
+	fmt.Fprint(w, "\x00")
+
+	if _, err := io.CopyN(dst, r, h.Size); err != nil {
+		return err
+	}
+
+	// The data is followed by a status byte, which we acknowledge
+	if err := checkSCPStatus(r); err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, "\x00")
+	return nil
+}
+
+func scpDownloadFile(dst io.Writer, w io.Writer, r *bufio.Reader) error {
+	// Tell the other side we're ready to receive
+	log.Println("Beginning file download...")
+	fmt.Fprint(w, "\x00")
+
+	h, err := readSCPHeader(r)
+	if err != nil {
+		return err
+	}
+
+	if h.Kind != 'C' {
+		return fmt.Errorf("Expected a file to download, got SCP message '%c'", h.Kind)
+	}
+
+	return scpDownloadFileData(h, dst, w, r)
+}
+
+func scpDownloadDir(dst string, contentsOnly bool, excl []string, w io.Writer, r *bufio.Reader) error {
+	// The stack of local directories we're currently in, and the
+	// matching paths relative to the source directory, which are used
+	// to check the exclusion list.
+	dirs := []string{dst}
+	rels := []string{""}
+
+	// When a directory is excluded we still have to read everything in
+	// it, we just don't write any of it. This tracks how deep we are
+	// into an excluded directory.
+	skipDepth := 0
+
+	// Tell the other side we're ready to receive
+	fmt.Fprint(w, "\x00")
+
+	for {
+		h, err := readSCPHeader(r)
+		if err != nil {
+			if err == io.EOF {
+				// The remote side is done sending
+				return nil
+			}
+
+			return err
+		}
+
+		cur := dirs[len(dirs)-1]
+		rel := filepath.Join(rels[len(rels)-1], h.Name)
+		skip := skipDepth > 0 || excluded(rel, excl)
+
+		switch h.Kind {
+		case 'C':
+			if skip {
+				log.Printf("SCP: skipping excluded file: %s", rel)
+				if err := scpDownloadFileData(h, ioutil.Discard, w, r); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			log.Printf("SCP: downloading file: %s", rel)
+			err := func() error {
+				f, err := os.OpenFile(filepath.Join(cur, h.Name),
+					os.O_WRONLY|os.O_CREATE|os.O_TRUNC, h.Mode)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				return scpDownloadFileData(h, f, w, r)
+			}()
+			if err != nil {
+				return err
+			}
+		case 'D':
+			path := filepath.Join(cur, h.Name)
+			if len(dirs) == 1 {
+				// The top-level directory is the source itself, so
+				// exclusions are relative to it. If we only want the
+				// contents then it maps to the destination itself.
+				rel = ""
+				skip = false
+				if contentsOnly {
+					path = dst
+				}
+			}
+
+			if skip {
+				skipDepth++
+			} else {
+				log.Printf("SCP: creating directory: %s", path)
+				if err := os.MkdirAll(path, h.Mode|0700); err != nil {
+					return err
+				}
+			}
+
+			dirs = append(dirs, path)
+			rels = append(rels, rel)
+			fmt.Fprint(w, "\x00")
+		case 'E':
+			if len(dirs) == 1 {
+				return errors.New("SCP: unexpected end of directory")
+			}
+
+			if skipDepth > 0 {
+				skipDepth--
+			}
+
+			dirs = dirs[:len(dirs)-1]
+			rels = rels[:len(rels)-1]
+			fmt.Fprint(w, "\x00")
+		}
+	}
+}
+
+// excluded returns true if the given path, relative to the root of a
+// directory transfer, matches any of the exclusion patterns.
+func excluded(path string, excl []string) bool {
+	for _, pattern := range excl {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
 func scpUploadFile(dst string, src io.Reader, w io.Writer, r *bufio.Reader) error {
 	// Create a temporary file where we can copy the contents of the src
 	// so that we can determine the length, since SCP is length-prefixed.
@@ -3,12 +3,18 @@
 package ssh
 
 import (
+	"bufio"
 	"bytes"
 	"code.google.com/p/go.crypto/ssh"
 	"fmt"
 	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // private key for mock server
@@ -130,6 +136,32 @@ func TestNew_Invalid(t *testing.T) {
 	}
 }
 
+func TestNew_HostKeyMismatch(t *testing.T) {
+	clientConfig := &ssh.ClientConfig{
+		User: "user",
+		Auth: []ssh.AuthMethod{
+			ssh.Password("pass"),
+		},
+		HostKeyCallback: FingerprintHostKeyCallback(
+			"00:11:22:33:44:55:66:77:88:99:aa:bb:cc:dd:ee:ff"),
+	}
+
+	address := newMockLineServer(t)
+	conn := func() (net.Conn, error) {
+		return net.Dial("tcp", address)
+	}
+
+	config := &Config{
+		Connection: conn,
+		SSHConfig:  clientConfig,
+	}
+
+	_, err := New(address, config)
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatalf("should have host key error: %#v", err)
+	}
+}
+
 func TestStart(t *testing.T) {
 	clientConfig := &ssh.ClientConfig{
 		User: "user",
@@ -164,3 +196,231 @@ func TestStart(t *testing.T) {
 
 	client.Start(&cmd)
 }
+
+// newMockRebootServer returns the address of a server that runs commands
+// successfully, except that the first command "reboots" the server by
+// dropping the connection without an exit status.
+func newMockRebootServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+
+	go func() {
+		defer l.Close()
+		for i := 0; i < 2; i++ {
+			c, err := l.Accept()
+			if err != nil {
+				t.Errorf("Unable to accept incoming connection: %s", err)
+				return
+			}
+
+			conn, chans, reqs, err := ssh.NewServerConn(c, serverConfig)
+			if err != nil {
+				t.Logf("Handshaking error: %v", err)
+				c.Close()
+				continue
+			}
+			go ssh.DiscardRequests(reqs)
+
+			reboot := i == 0
+			for newChannel := range chans {
+				channel, reqs, err := newChannel.Accept()
+				if err != nil {
+					t.Errorf("Unable to accept channel.")
+					continue
+				}
+
+				for req := range reqs {
+					req.Reply(req.Type == "exec", nil)
+					if req.Type != "exec" {
+						continue
+					}
+
+					if reboot {
+						conn.Close()
+						break
+					}
+
+					status := struct{ Status uint32 }{0}
+					channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+					channel.Close()
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestStart_disconnect(t *testing.T) {
+	clientConfig := &ssh.ClientConfig{
+		User: "user",
+		Auth: []ssh.AuthMethod{
+			ssh.Password("pass"),
+		},
+	}
+
+	address := newMockRebootServer(t)
+	config := &Config{
+		Connection:       ConnectFunc("tcp", address),
+		SSHConfig:        clientConfig,
+		NoPty:            true,
+		ReconnectTimeout: 10 * time.Second,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	// The first command loses the connection
+	cmd := &packer.RemoteCmd{Command: "reboot", ReportDisconnect: true}
+	if err := client.Start(cmd); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cmd.Wait()
+
+	if cmd.ExitStatus != packer.CmdDisconnect {
+		t.Fatalf("bad: %d", cmd.ExitStatus)
+	}
+
+	// The next command should reconnect
+	cmd = &packer.RemoteCmd{Command: "true"}
+	if err := client.Start(cmd); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cmd.Wait()
+
+	if cmd.ExitStatus != 0 {
+		t.Fatalf("bad: %d", cmd.ExitStatus)
+	}
+}
+
+func TestScpDownloadFile(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("C0644 5 foo\nhello\x00"))
+	w := new(bytes.Buffer)
+	dst := new(bytes.Buffer)
+
+	if err := scpDownloadFile(dst, w, r); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if dst.String() != "hello" {
+		t.Fatalf("bad: %q", dst.String())
+	}
+
+	if w.String() != "\x00\x00\x00" {
+		t.Fatalf("bad acks: %q", w.String())
+	}
+}
+
+func TestScpDownloadFile_remoteError(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\x01scp: /foo: No such file or directory\n"))
+	w := new(bytes.Buffer)
+	dst := new(bytes.Buffer)
+
+	err := scpDownloadFile(dst, w, r)
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	if !strings.Contains(err.Error(), "No such file") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestScpDownloadFile_directory(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("D0755 0 foo\n"))
+	w := new(bytes.Buffer)
+	dst := new(bytes.Buffer)
+
+	if err := scpDownloadFile(dst, w, r); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestScpDownloadDir_badName(t *testing.T) {
+	streams := []string{
+		"D0755 0 src\nC0644 3 ../a.txt\nfoo\x00E\n",
+		"D0755 0 src\nD0755 0 ..\nC0644 3 a.txt\nfoo\x00E\nE\n",
+		"D0755 0 src\nD0755 0 .\nE\nE\n",
+		"D0755 0 src\nC0644 3 sub/a.txt\nfoo\x00E\n",
+		"D0755 0 /tmp\nE\n",
+	}
+
+	for _, stream := range streams {
+		td, err := ioutil.TempDir("", "packer")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer os.RemoveAll(td)
+
+		dst := filepath.Join(td, "dst")
+		r := bufio.NewReader(strings.NewReader(stream))
+		w := new(bytes.Buffer)
+		if err := scpDownloadDir(dst, false, nil, w, r); err == nil {
+			t.Fatalf("should error: %q", stream)
+		}
+
+		if _, err := os.Stat(filepath.Join(td, "a.txt")); err == nil {
+			t.Fatalf("file written outside the destination: %q", stream)
+		}
+	}
+}
+
+func TestScpDownloadDir(t *testing.T) {
+	stream := "D0755 0 src\n" +
+		"C0644 3 a.txt\nfoo\x00" +
+		"D0755 0 sub\n" +
+		"C0600 3 b.txt\nbar\x00" +
+		"E\n" +
+		"D0755 0 skipped\n" +
+		"C0644 3 c.txt\nbaz\x00" +
+		"E\n" +
+		"E\n"
+
+	cases := []struct {
+		ContentsOnly bool
+		Root         string
+	}{
+		{false, "src"},
+		{true, ""},
+	}
+
+	for _, tc := range cases {
+		td, err := ioutil.TempDir("", "packer")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer os.RemoveAll(td)
+
+		r := bufio.NewReader(strings.NewReader(stream))
+		w := new(bytes.Buffer)
+		err = scpDownloadDir(td, tc.ContentsOnly, []string{"skipped"}, w, r)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		root := filepath.Join(td, tc.Root)
+		expected := map[string]string{
+			"a.txt":     "foo",
+			"sub/b.txt": "bar",
+		}
+		for path, contents := range expected {
+			data, err := ioutil.ReadFile(filepath.Join(root, path))
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if string(data) != contents {
+				t.Fatalf("bad %s: %q", path, data)
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(root, "skipped")); err == nil {
+			t.Fatal("excluded directory should not exist")
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/go.crypto/ssh"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// HostKeyError is returned when the host key of the remote end fails
+// verification. Unlike other connection errors, retrying won't help.
+type HostKeyError struct {
+	Host        string
+	Fingerprint string
+	Reason      string
+}
+
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf(
+		"Host key verification failed for %s (fingerprint %s): %s",
+		e.Host, e.Fingerprint, e.Reason)
+}
+
+// Fingerprint returns the MD5 fingerprint of the key in the colon
+// separated hex format that OpenSSH uses, such as "8c:2d:...".
+func Fingerprint(key ssh.PublicKey) string {
+	sum := md5.Sum(key.Marshal())
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// FingerprintSHA256 returns the SHA256 fingerprint of the key in the
+// format that newer versions of OpenSSH use, such as "SHA256:nThbg6...".
+func FingerprintSHA256(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	hash := base64.StdEncoding.EncodeToString(sum[:])
+	return "SHA256:" + strings.TrimRight(hash, "=")
+}
+
+// ValidFingerprint returns an error if the fingerprint isn't in one of
+// the formats accepted by FingerprintHostKeyCallback.
+func ValidFingerprint(fingerprint string) error {
+	fingerprint = strings.TrimSpace(fingerprint)
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		hash := strings.TrimRight(fingerprint[len("SHA256:"):], "=")
+		if _, err := base64.StdEncoding.DecodeString(padBase64(hash)); err != nil {
+			return fmt.Errorf("invalid SHA256 fingerprint: %s", err)
+		}
+
+		return nil
+	}
+
+	parts := strings.Split(trimMD5Prefix(fingerprint), ":")
+	if len(parts) != md5.Size {
+		return fmt.Errorf("invalid MD5 fingerprint: expected %d colon separated bytes", md5.Size)
+	}
+
+	for _, part := range parts {
+		if _, err := hex.DecodeString(part); err != nil || len(part) != 2 {
+			return fmt.Errorf("invalid MD5 fingerprint: bad byte '%s'", part)
+		}
+	}
+
+	return nil
+}
+
+// FingerprintHostKeyCallback returns a host key callback for the SSH
+// client configuration that only accepts the host key with the given
+// fingerprint. Both the MD5 hex format and the "SHA256:" format are
+// accepted.
+func FingerprintHostKeyCallback(fingerprint string) func(string, net.Addr, ssh.PublicKey) error {
+	fingerprint = strings.TrimSpace(fingerprint)
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		var actual string
+		var ok bool
+		if strings.HasPrefix(fingerprint, "SHA256:") {
+			actual = FingerprintSHA256(key)
+			ok = strings.TrimRight(fingerprint, "=") == actual
+		} else {
+			actual = Fingerprint(key)
+			ok = strings.ToLower(trimMD5Prefix(fingerprint)) == actual
+		}
+
+		if !ok {
+			return &HostKeyError{
+				Host:        hostname,
+				Fingerprint: actual,
+				Reason:      fmt.Sprintf("expected fingerprint %s", fingerprint),
+			}
+		}
+
+		return nil
+	}
+}
+
+// KnownHostsHostKeyCallback returns a host key callback for the SSH
+// client configuration that verifies host keys against the OpenSSH
+// known_hosts file at the given path. Hosts that aren't in the file are
+// rejected, as are revoked keys.
+func KnownHostsHostKeyCallback(path string) (func(string, net.Addr, ssh.PublicKey) error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hosts, err := parseKnownHosts(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing known hosts file '%s': %s", path, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		names := []string{knownHostsName(hostname)}
+		if addr, ok := remote.(*net.TCPAddr); ok {
+			names = append(names, knownHostsName(addr.String()))
+		}
+
+		keyBytes := key.Marshal()
+		found := false
+		for _, h := range hosts {
+			if h.marker == "@revoked" && bytes.Equal(h.key.Marshal(), keyBytes) {
+				return &HostKeyError{
+					Host:        hostname,
+					Fingerprint: Fingerprint(key),
+					Reason:      fmt.Sprintf("key is marked as revoked in %s", path),
+				}
+			}
+		}
+
+		for _, h := range hosts {
+			if h.marker != "" || !h.match(names) {
+				continue
+			}
+
+			if bytes.Equal(h.key.Marshal(), keyBytes) {
+				return nil
+			}
+
+			found = true
+		}
+
+		reason := fmt.Sprintf("host not found in %s", path)
+		if found {
+			reason = fmt.Sprintf(
+				"key does not match the one in %s. It is possible that "+
+					"someone is intercepting the connection", path)
+		}
+
+		return &HostKeyError{
+			Host:        hostname,
+			Fingerprint: Fingerprint(key),
+			Reason:      reason,
+		}
+	}, nil
+}
+
+// MultiHostKeyCallback returns a host key callback that only accepts a
+// host key if every one of the given callbacks accepts it.
+func MultiHostKeyCallback(cbs ...func(string, net.Addr, ssh.PublicKey) error) func(string, net.Addr, ssh.PublicKey) error {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, cb := range cbs {
+			if err := cb(hostname, remote, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// knownHost is a single entry in a known_hosts file.
+type knownHost struct {
+	marker   string
+	patterns []string
+	key      ssh.PublicKey
+}
+
+// match returns true if any of the names match the host patterns of
+// the entry and none of them match a negated pattern.
+func (h *knownHost) match(names []string) bool {
+	matched := false
+	for _, name := range names {
+		for _, pattern := range h.patterns {
+			negate := strings.HasPrefix(pattern, "!")
+			if negate {
+				pattern = pattern[1:]
+			}
+
+			if !matchHostPattern(pattern, name) {
+				continue
+			}
+
+			if negate {
+				return false
+			}
+
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+func parseKnownHosts(r io.Reader) ([]*knownHost, error) {
+	result := make([]*knownHost, 0)
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		h := new(knownHost)
+		fields := strings.Fields(line)
+		if strings.HasPrefix(fields[0], "@") {
+			h.marker = fields[0]
+			fields = fields[1:]
+		}
+
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected hosts, key type and key", lineNum)
+		}
+
+		keyBytes, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+
+		h.key, err = ssh.ParsePublicKey(keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+
+		h.patterns = strings.Split(fields[0], ",")
+		result = append(result, h)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// knownHostsName returns the name of the "host:port" address as it is
+// written in known_hosts files: just the host for the default port, and
+// "[host]:port" otherwise.
+func knownHostsName(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	if port == "22" {
+		return host
+	}
+
+	return fmt.Sprintf("[%s]:%s", host, port)
+}
+
+// matchHostPattern matches the name against a single known_hosts
+// pattern, which is either a hashed name ("|1|salt|hash") or a name
+// with '*' and '?' wildcards.
+func matchHostPattern(pattern, name string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[3:], "|")
+		if len(parts) != 2 {
+			return false
+		}
+
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(name))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+
+	return matchWildcard(strings.ToLower(pattern), strings.ToLower(name))
+}
+
+func matchWildcard(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if matchWildcard(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+func trimMD5Prefix(fingerprint string) string {
+	if strings.HasPrefix(strings.ToUpper(fingerprint), "MD5:") {
+		return fingerprint[len("MD5:"):]
+	}
+
+	return fingerprint
+}
+
+func padBase64(s string) string {
+	if n := len(s) % 4; n != 0 {
+		s += strings.Repeat("=", 4-n)
+	}
+
+	return s
+}
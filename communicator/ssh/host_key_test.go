@@ -0,0 +1,175 @@
+package ssh
+
+import (
+	"bytes"
+	"code.google.com/p/go.crypto/ssh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	signer, err := ssh.ParsePrivateKey([]byte(testServerPrivateKey))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return signer.PublicKey()
+}
+
+func testKnownHostsLine(hosts string, key ssh.PublicKey) string {
+	return hosts + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + "\n"
+}
+
+func TestFingerprintHostKeyCallback(t *testing.T) {
+	key := testHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	good := []string{
+		Fingerprint(key),
+		strings.ToUpper(Fingerprint(key)),
+		"MD5:" + Fingerprint(key),
+		FingerprintSHA256(key),
+	}
+
+	for _, fp := range good {
+		if err := ValidFingerprint(fp); err != nil {
+			t.Fatalf("bad fingerprint %s: %s", fp, err)
+		}
+
+		if err := FingerprintHostKeyCallback(fp)("foo:22", addr, key); err != nil {
+			t.Fatalf("bad fingerprint %s: %s", fp, err)
+		}
+	}
+
+	other := "00:11:22:33:44:55:66:77:88:99:aa:bb:cc:dd:ee:ff"
+	err := FingerprintHostKeyCallback(other)("foo:22", addr, key)
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	if err := ValidFingerprint("nope"); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestKnownHostsHostKeyCallback(t *testing.T) {
+	key := testHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2222}
+
+	// Hash "hashed.example.com" the same way OpenSSH does
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("hashed.example.com"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) +
+		"|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	var buf bytes.Buffer
+	buf.WriteString("# comment\n\n")
+	buf.WriteString(testKnownHostsLine("foo.example.com,bar.example.com", key))
+	buf.WriteString(testKnownHostsLine("[baz.example.com]:2222", key))
+	buf.WriteString(testKnownHostsLine("*.wild.com,!bad.wild.com", key))
+	buf.WriteString(testKnownHostsLine(hashed, key))
+
+	path := testKeyFile(t, buf.String())
+	defer os.Remove(path)
+
+	cb, err := KnownHostsHostKeyCallback(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, host := range []string{
+		"foo.example.com:22",
+		"BAR.example.com:22",
+		"baz.example.com:2222",
+		"good.wild.com:22",
+		"hashed.example.com:22",
+	} {
+		if err := cb(host, addr, key); err != nil {
+			t.Fatalf("bad %s: %s", host, err)
+		}
+	}
+
+	for _, host := range []string{
+		"baz.example.com:22",
+		"unknown.example.com:22",
+		"bad.wild.com:22",
+	} {
+		err := cb(host, addr, key)
+		if _, ok := err.(*HostKeyError); !ok {
+			t.Fatalf("bad %s: %#v", host, err)
+		}
+	}
+}
+
+func TestKnownHostsHostKeyCallback_mismatch(t *testing.T) {
+	key := testHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	other, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	path := testKeyFile(t, testKnownHostsLine("foo.example.com", other))
+	defer os.Remove(path)
+
+	cb, err := KnownHostsHostKeyCallback(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = cb("foo.example.com:22", addr, key)
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	if !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestKnownHostsHostKeyCallback_revoked(t *testing.T) {
+	key := testHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	path := testKeyFile(t,
+		testKnownHostsLine("foo.example.com", key)+
+			testKnownHostsLine("@revoked *", key))
+	defer os.Remove(path)
+
+	cb, err := KnownHostsHostKeyCallback(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = cb("foo.example.com:22", addr, key)
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestKnownHostsHostKeyCallback_invalid(t *testing.T) {
+	path := testKeyFile(t, "foo.example.com ssh-rsa\n")
+	defer os.Remove(path)
+
+	if _, err := KnownHostsHostKeyCallback(path); err == nil {
+		t.Fatal("should have error")
+	}
+
+	if _, err := KnownHostsHostKeyCallback("/i/dont/exist"); err == nil {
+		t.Fatal("should have error")
+	}
+}
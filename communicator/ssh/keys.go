@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+	"code.google.com/p/go.crypto/ssh/agent"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+)
+
+// FileSigner returns an ssh.Signer for the private key stored in the
+// file at the given path.
+func FileSigner(path string) (ssh.Signer, error) {
+	keyBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading private key '%s': %s", path, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing private key '%s': %s", path, err)
+	}
+
+	return signer, nil
+}
+
+// AgentSigners returns the signers for all the keys held by the SSH agent
+// listening on SSH_AUTH_SOCK. No connection to the agent is kept open:
+// the keys are listed over one connection, and each signature is made
+// over a connection of its own.
+func AgentSigners() ([]ssh.Signer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set, is an SSH agent running?")
+	}
+
+	var keys []*agent.Key
+	err := withAgent(sock, func(a agent.Agent) error {
+		var err error
+		keys, err = a.List()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing keys in SSH agent: %s", err)
+	}
+
+	signers := make([]ssh.Signer, len(keys))
+	for i, key := range keys {
+		signers[i] = &agentSigner{sock: sock, key: key}
+	}
+
+	return signers, nil
+}
+
+// withAgent connects to the SSH agent listening on the socket and calls
+// f with a client for it, closing the connection afterwards.
+func withAgent(sock string, f func(agent.Agent) error) error {
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return fmt.Errorf("Error connecting to SSH agent at '%s': %s", sock, err)
+	}
+	defer conn.Close()
+
+	return f(agent.NewClient(conn))
+}
+
+// agentSigner is an ssh.Signer for a key held by the SSH agent.
+type agentSigner struct {
+	sock string
+	key  ssh.PublicKey
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	var sig *ssh.Signature
+	err := withAgent(s.sock, func(a agent.Agent) error {
+		var err error
+		sig, err = a.Sign(s.key, data)
+		return err
+	})
+
+	return sig, err
+}
+
+// KeyAuth is the set of public keys to authenticate with.
+//
+// The SSH client only attempts the "publickey" method once, so every
+// key must be offered through the single ssh.AuthMethod returned by
+// AuthMethod rather than one method per key.
+type KeyAuth struct {
+	// Signers are keys that are offered first, such as a key generated
+	// by the builder for this machine.
+	Signers []ssh.Signer
+
+	// Files are paths to private key files, offered in order.
+	Files []string
+
+	// Agent, if true, offers the keys held by the running SSH agent last.
+	Agent bool
+}
+
+// Empty returns true if there are no keys to authenticate with.
+func (k *KeyAuth) Empty() bool {
+	return len(k.Signers) == 0 && len(k.Files) == 0 && !k.Agent
+}
+
+// AuthMethod returns an ssh.AuthMethod offering all the keys. The key
+// files and the agent are only read when authenticating.
+func (k *KeyAuth) AuthMethod() ssh.AuthMethod {
+	return ssh.PublicKeysCallback(k.signers)
+}
+
+// signers returns the keys to offer. A key file or agent that can't be
+// used is logged and skipped, so that the other keys are still offered.
+// An error is only returned if none of the keys can be used.
+func (k *KeyAuth) signers() ([]ssh.Signer, error) {
+	result := make([]ssh.Signer, 0, len(k.Signers)+len(k.Files))
+	result = append(result, k.Signers...)
+
+	var firstErr error
+	for _, path := range k.Files {
+		signer, err := FileSigner(path)
+		if err != nil {
+			log.Printf("[WARN] Skipping private key: %s", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		result = append(result, signer)
+	}
+
+	if k.Agent {
+		signers, err := AgentSigners()
+		if err != nil {
+			log.Printf("[WARN] Skipping SSH agent keys: %s", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		result = append(result, signers...)
+	}
+
+	if len(result) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	return result, nil
+}
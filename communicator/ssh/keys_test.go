@@ -0,0 +1,192 @@
+package ssh
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+	"code.google.com/p/go.crypto/ssh/agent"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testKeyFile(t *testing.T, contents string) string {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tf.Close()
+
+	if _, err := tf.Write([]byte(contents)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return tf.Name()
+}
+
+func TestFileSigner(t *testing.T) {
+	path := testKeyFile(t, testServerPrivateKey)
+	defer os.Remove(path)
+
+	if _, err := FileSigner(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	bad := testKeyFile(t, "not a key")
+	defer os.Remove(bad)
+
+	if _, err := FileSigner(bad); err == nil {
+		t.Fatal("should have error")
+	}
+
+	if _, err := FileSigner("/i/dont/exist"); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestKeyAuth(t *testing.T) {
+	path := testKeyFile(t, testServerPrivateKey)
+	defer os.Remove(path)
+
+	k := new(KeyAuth)
+	if !k.Empty() {
+		t.Fatal("should be empty")
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(testServerPrivateKey))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	k = &KeyAuth{
+		Signers: []ssh.Signer{signer},
+		Files:   []string{path, path},
+	}
+	if k.Empty() {
+		t.Fatal("should not be empty")
+	}
+
+	signers, err := k.signers()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(signers) != 3 {
+		t.Fatalf("bad: %d", len(signers))
+	}
+
+	// A key that can't be read is skipped
+	k.Files = append(k.Files, "/i/dont/exist")
+	signers, err = k.signers()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(signers) != 3 {
+		t.Fatalf("bad: %d", len(signers))
+	}
+
+	// Unless there are no keys at all
+	k = &KeyAuth{Files: []string{"/i/dont/exist"}}
+	if _, err := k.signers(); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestKeyAuth_agentNotRunning(t *testing.T) {
+	old := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", old)
+	os.Setenv("SSH_AUTH_SOCK", "")
+
+	k := &KeyAuth{Agent: true}
+	if _, err := k.signers(); err == nil {
+		t.Fatal("should have error")
+	}
+
+	// The other keys are still offered
+	signer, err := ssh.ParsePrivateKey([]byte(testServerPrivateKey))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	k.Signers = []ssh.Signer{signer}
+	signers, err := k.signers()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("bad: %d", len(signers))
+	}
+}
+
+func TestAgentSigners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ssh.ParseRawPrivateKey([]byte(testServerPrivateKey))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer l.Close()
+
+	// Count the connections that are still open
+	var open int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			atomic.AddInt32(&open, 1)
+			go func() {
+				agent.ServeAgent(keyring, c)
+				c.Close()
+				atomic.AddInt32(&open, -1)
+			}()
+		}
+	}()
+
+	old := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", old)
+	os.Setenv("SSH_AUTH_SOCK", sock)
+
+	signers, err := AgentSigners()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("bad: %d", len(signers))
+	}
+
+	data := []byte("data")
+	sig, err := signers[0].Sign(nil, data)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := signers[0].PublicKey().Verify(data, sig); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for i := 0; i < 100 && atomic.LoadInt32(&open) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&open); n != 0 {
+		t.Fatalf("agent connections left open: %d", n)
+	}
+}
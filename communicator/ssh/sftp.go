@@ -0,0 +1,277 @@
+package ssh
+
+import (
+	"fmt"
+	"github.com/pkg/sftp"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// sftpSession opens a new SSH session with the SFTP subsystem and calls
+// f with a client for it. The session is closed when f returns.
+func (c *comm) sftpSession(f func(*sftp.Client) error) error {
+	session, err := c.newSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdinW, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdoutR, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	log.Println("Starting remote SFTP subsystem")
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return fmt.Errorf(
+			"SFTP failed to start: %s\n\nThis usually means that SFTP is not\n"+
+				"enabled on the remote system.", err)
+	}
+
+	client, err := sftp.NewClientPipe(stdoutR, stdinW)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return f(client)
+}
+
+func (c *comm) sftpUpload(dst string, input io.Reader) error {
+	dst = filepath.ToSlash(dst)
+	return c.sftpSession(func(client *sftp.Client) error {
+		return sftpUploadFile(client, dst, input, 0644)
+	})
+}
+
+func (c *comm) sftpUploadDir(dst string, src string, excl []string) error {
+	return c.sftpSession(func(client *sftp.Client) error {
+		return sftpUploadTree(client, filepath.ToSlash(dst), src, excl)
+	})
+}
+
+func (c *comm) sftpDownload(src string, output io.Writer) error {
+	src = filepath.ToSlash(src)
+	return c.sftpSession(func(client *sftp.Client) error {
+		f, err := client.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(output, f)
+		return err
+	})
+}
+
+func (c *comm) sftpDownloadDir(src string, dst string, excl []string) error {
+	return c.sftpSession(func(client *sftp.Client) error {
+		return sftpDownloadTree(client, filepath.ToSlash(src), dst, excl)
+	})
+}
+
+// sftpUploadTree uploads the local directory src to the remote directory
+// dst, with the same trailing slash semantics as the SCP upload: without
+// one, the source directory itself is created in the destination.
+func sftpUploadTree(client *sftp.Client, dst string, src string, excl []string) error {
+	if src[len(src)-1] != '/' {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+
+	return sftpUploadDirEntries(client, dst, src, "", excl)
+}
+
+// sftpUploadDirEntries creates the remote directory dst and uploads the
+// contents of the local directory dir into it. rel is the path of dir
+// relative to the upload source, which exclusions are matched against.
+// Symlinks are followed, like scpUploadDir does.
+func sftpUploadDirEntries(client *sftp.Client, dst string, dir string, rel string, excl []string) error {
+	if err := sftpMkdir(client, dst); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		localPath := filepath.Join(dir, entry.Name())
+		remotePath := path.Join(dst, entry.Name())
+		relpath := filepath.Join(rel, entry.Name())
+		if excluded(relpath, excl) {
+			log.Printf("SFTP: skipping excluded path: %s", relpath)
+			continue
+		}
+
+		// Get the info of the real file if this is a symlink
+		fi, err := os.Stat(localPath)
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if err := sftpUploadDirEntries(client, remotePath, localPath, relpath, excl); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err = func() error {
+			f, err := os.Open(localPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			log.Printf("SFTP: uploading file: %s", remotePath)
+			return sftpUploadFile(client, remotePath, f, fi.Mode())
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sftpDownloadTree downloads the remote path src to the local directory
+// dst, behaving like the SCP download. A directory is created in dst
+// unless src has a trailing slash, in which case only its contents are
+// downloaded. A file is downloaded into dst.
+func sftpDownloadTree(client *sftp.Client, src string, dst string, excl []string) error {
+	contentsOnly := src[len(src)-1] == '/'
+	src = path.Clean(src)
+
+	fi, err := client.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		if contentsOnly {
+			return fmt.Errorf("Not a directory: %s", src)
+		}
+
+		name := path.Base(src)
+		if excluded(name, excl) {
+			log.Printf("SFTP: skipping excluded file: %s", name)
+			return nil
+		}
+
+		log.Printf("SFTP: downloading file: %s", src)
+		return sftpDownloadFile(client, src, filepath.Join(dst, name), fi.Mode().Perm())
+	}
+
+	if !contentsOnly {
+		dst = filepath.Join(dst, path.Base(src))
+	}
+
+	return sftpDownloadDirEntries(client, src, dst, "", fi.Mode(), excl)
+}
+
+// sftpDownloadDirEntries creates the local directory dst with the given
+// mode and downloads the contents of the remote directory dir into it.
+// rel is the path of dir relative to the download source, which
+// exclusions are matched against. Symlinks are followed, like the SCP
+// download does.
+func sftpDownloadDirEntries(client *sftp.Client, dir string, dst string, rel string, mode os.FileMode, excl []string) error {
+	log.Printf("SFTP: creating directory: %s", dst)
+	if err := os.MkdirAll(dst, mode.Perm()|0700); err != nil {
+		return err
+	}
+
+	entries, err := client.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		remotePath := path.Join(dir, entry.Name())
+		localPath := filepath.Join(dst, entry.Name())
+		relpath := path.Join(rel, entry.Name())
+		if excluded(filepath.FromSlash(relpath), excl) {
+			log.Printf("SFTP: skipping excluded path: %s", relpath)
+			continue
+		}
+
+		fi := entry
+		if fi.Mode()&os.ModeSymlink != 0 {
+			// Get the info of the real file the symlink points to
+			if fi, err = client.Stat(remotePath); err != nil {
+				return err
+			}
+		}
+
+		if fi.IsDir() {
+			err = sftpDownloadDirEntries(client, remotePath, localPath, relpath, fi.Mode(), excl)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		log.Printf("SFTP: downloading file: %s", remotePath)
+		if err := sftpDownloadFile(client, remotePath, localPath, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sftpMkdir creates the remote directory if it doesn't exist yet.
+func sftpMkdir(client *sftp.Client, dir string) error {
+	if fi, err := client.Stat(dir); err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("Remote path exists and is not a directory: %s", dir)
+		}
+
+		return nil
+	}
+
+	log.Printf("SFTP: creating directory: %s", dir)
+	return client.Mkdir(dir)
+}
+
+func sftpUploadFile(client *sftp.Client, dst string, src io.Reader, mode os.FileMode) error {
+	f, err := client.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, src); err != nil {
+		return err
+	}
+
+	return client.Chmod(dst, mode.Perm())
+}
+
+func sftpDownloadFile(client *sftp.Client, src string, dst string, mode os.FileMode) error {
+	rf, err := client.Open(src)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
+	lf, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+
+	_, err = io.Copy(lf, rf)
+	return err
+}
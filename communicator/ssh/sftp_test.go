@@ -0,0 +1,247 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pkg/sftp"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSftpClient returns a client for an SFTP server running in this
+// process, serving the local filesystem.
+func testSftpClient(t *testing.T) *sftp.Client {
+	c1, c2 := net.Pipe()
+
+	server, err := sftp.NewServer(c1)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(c2, c2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return client
+}
+
+// testSftpTree creates a directory "src" in dir with a few files, a
+// symlink "link" to its directory "sub", and a directory "skipped" in it
+// to test exclusions.
+func testSftpTree(t *testing.T, dir string) string {
+	src := filepath.Join(dir, "src")
+	files := map[string]string{
+		"a.txt":         "foo",
+		"sub/b.txt":     "bar",
+		"skipped/c.txt": "baz",
+	}
+
+	for path, contents := range files {
+		path = filepath.Join(src, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(src, "sub"), filepath.Join(src, "link")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return src
+}
+
+// testSftpCheckTree checks that root has the files of testSftpTree,
+// except for the excluded ones. The symlinked directory must have been
+// copied as a real directory.
+func testSftpCheckTree(t *testing.T, root string) {
+	expected := map[string]string{
+		"a.txt":      "foo",
+		"sub/b.txt":  "bar",
+		"link/b.txt": "bar",
+	}
+
+	for path, contents := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if string(data) != contents {
+			t.Fatalf("bad %s: %q", path, data)
+		}
+	}
+
+	fi, err := os.Lstat(filepath.Join(root, "link"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !fi.IsDir() {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "skipped")); err == nil {
+		t.Fatal("excluded directory should not exist")
+	}
+}
+
+func TestSftpUploadFile(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	client := testSftpClient(t)
+	defer client.Close()
+
+	dst := filepath.ToSlash(filepath.Join(td, "foo"))
+	if err := sftpUploadFile(client, dst, strings.NewReader("hello"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestSftpUploadTree(t *testing.T) {
+	cases := []struct {
+		TrailingSlash bool
+		Root          string
+	}{
+		{false, "src"},
+		{true, ""},
+	}
+
+	for _, tc := range cases {
+		td, err := ioutil.TempDir("", "packer")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer os.RemoveAll(td)
+
+		src := testSftpTree(t, td)
+		if tc.TrailingSlash {
+			src += "/"
+		}
+
+		dst := filepath.Join(td, "dst")
+		if err := os.Mkdir(dst, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		client := testSftpClient(t)
+		defer client.Close()
+
+		err = sftpUploadTree(client, filepath.ToSlash(dst), src, []string{"skipped"})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		testSftpCheckTree(t, filepath.Join(dst, tc.Root))
+	}
+}
+
+func TestSftpDownloadTree(t *testing.T) {
+	cases := []struct {
+		TrailingSlash bool
+		Root          string
+	}{
+		{false, "src"},
+		{true, ""},
+	}
+
+	for _, tc := range cases {
+		td, err := ioutil.TempDir("", "packer")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer os.RemoveAll(td)
+
+		src := filepath.ToSlash(testSftpTree(t, td))
+		if tc.TrailingSlash {
+			src += "/"
+		}
+
+		client := testSftpClient(t)
+		defer client.Close()
+
+		dst := filepath.Join(td, "dst")
+		if err := sftpDownloadTree(client, src, dst, []string{"skipped"}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		testSftpCheckTree(t, filepath.Join(dst, tc.Root))
+	}
+}
+
+func TestSftpDownloadTree_file(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(testSftpTree(t, td), "a.txt")
+
+	// SCP downloads the file into the destination directory
+	scpDst := filepath.Join(td, "scp")
+	if err := os.Mkdir(scpDst, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := bufio.NewReader(strings.NewReader("C0644 3 a.txt\nfoo\x00"))
+	if err := scpDownloadDir(scpDst, false, nil, new(bytes.Buffer), r); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// And so does SFTP
+	sftpDst := filepath.Join(td, "sftp")
+	if err := os.Mkdir(sftpDst, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	client := testSftpClient(t)
+	defer client.Close()
+
+	if err := sftpDownloadTree(client, filepath.ToSlash(src), sftpDst, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, dst := range []string{scpDst, sftpDst} {
+		data, err := ioutil.ReadFile(filepath.Join(dst, "a.txt"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(data) != "foo" {
+			t.Fatalf("bad %s: %q", dst, data)
+		}
+	}
+
+	// A file can't be treated as a directory
+	if err := sftpDownloadTree(client, filepath.ToSlash(src)+"/", sftpDst, nil); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -38,6 +38,7 @@ const defaultConfig = `
 
 	"commands": {
 		"build": "packer-command-build",
+		"cache": "packer-command-cache",
 		"fix": "packer-command-fix",
 		"inspect": "packer-command-inspect",
 		"validate": "packer-command-validate"
@@ -48,7 +49,8 @@ const defaultConfig = `
 		"vsphere": "packer-post-processor-vsphere",
 		"docker-push": "packer-post-processor-docker-push",
 		"docker-import": "packer-post-processor-docker-import",
-		"vagrant-cloud": "packer-post-processor-vagrant-cloud"
+		"vagrant-cloud": "packer-post-processor-vagrant-cloud",
+		"manifest": "packer-post-processor-manifest"
 	},
 
 	"provisioners": {
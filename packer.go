@@ -4,6 +4,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"github.com/mitchellh/packer/common/uuid"
 	"github.com/mitchellh/packer/packer"
 	"github.com/mitchellh/packer/packer/plugin"
 	"github.com/mitchellh/panicwrap"
@@ -76,7 +77,10 @@ func realMain() int {
 // wrappedMain is called only when we're wrapped by panicwrap and
 // returns the exit status to exit with.
 func wrappedMain() int {
-	log.SetOutput(os.Stderr)
+	// Logs go through the secret filter so that the values of sensitive
+	// variables never end up in them.
+	packer.LogSecretFilter.SetOutput(os.Stderr)
+	log.SetOutput(packer.LogSecretFilter)
 
 	log.Printf(
 		"Packer Version: %s %s %s",
@@ -84,6 +88,12 @@ func wrappedMain() int {
 	log.Printf("Packer Target OS/Arch: %s %s", runtime.GOOS, runtime.GOARCH)
 	log.Printf("Built with Go Version: %s", runtime.Version())
 
+	// The plugins inherit the environment, which gives all the builds of
+	// this run the same UUID for the manifest post-processor.
+	runUUID := uuid.TimeOrderedUUID()
+	os.Setenv("PACKER_RUN_UUID", runUUID)
+	log.Printf("Packer run UUID: %s", runUUID)
+
 	// Prepare stdin for plugin usage by switching it to a pipe
 	setupStdin()
 
@@ -107,6 +117,7 @@ func wrappedMain() int {
 	}
 
 	log.Printf("Setting cache directory: %s", cacheDir)
+	os.Setenv("PACKER_CACHE_DIR", cacheDir)
 	cache := &packer.FileCache{CacheDir: cacheDir}
 
 	// Determine if we're in machine-readable mode by mucking around with
@@ -1,6 +1,7 @@
 package packer
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
@@ -24,9 +25,31 @@ const (
 	// force build is enabled.
 	ForceConfigKey = "packer_force"
 
+	// This is the key in configurations that is set to what builders
+	// should do when a step fails. It is one of the OnError values.
+	OnErrorConfigKey = "packer_on_error"
+
 	// This key contains a map[string]string of the user variables for
 	// template processing.
 	UserVariablesConfigKey = "packer_user_variables"
+
+	// This is the key in configurations that is set to the path of the
+	// template file, if the template was read from a file.
+	TemplatePathConfigKey = "packer_template_path"
+
+	// This key contains the artifacts of the builds that the build depends
+	// on, as a JSON encoded map of BuildArtifact by build name.
+	BuildArtifactsConfigKey = "packer_build_artifacts"
+)
+
+// These are the values of OnErrorConfigKey. With OnErrorCleanup, which is
+// the default, everything the build created is cleaned up on failure.
+// OnErrorAbort leaves everything in place, and OnErrorAsk asks the user
+// whether to clean up, abort or retry the step that failed.
+const (
+	OnErrorCleanup = "cleanup"
+	OnErrorAbort   = "abort"
+	OnErrorAsk     = "ask"
 )
 
 // A Build represents a single job within Packer that is responsible for
@@ -64,6 +87,22 @@ type Build interface {
 	// When SetForce is set to true, existing artifacts from the build are
 	// deleted prior to the build.
 	SetForce(bool)
+
+	// SetOnError sets what the builder does when the build fails. It is
+	// one of the OnError values, and is added to the configuration of the
+	// components with the key "packer_on_error". This must be called
+	// prior to Prepare.
+	SetOnError(string)
+
+	// DependsOn returns the names of the builds that this build depends
+	// on. Those builds must finish successfully before this one is
+	// prepared.
+	DependsOn() []string
+
+	// SetDependencyArtifact sets the artifact of a build that this build
+	// depends on, making it available to the templates of this build.
+	// This must be called before Prepare.
+	SetDependencyArtifact(string, BuildArtifact)
 }
 
 // A build struct represents a single build job, the result of which should
@@ -75,13 +114,18 @@ type coreBuild struct {
 	builder        Builder
 	builderConfig  interface{}
 	builderType    string
+	dependsOn      []string
 	hooks          map[string][]Hook
 	postProcessors [][]coreBuildPostProcessor
 	provisioners   []coreBuildProvisioner
+	templatePath   string
 	variables      map[string]string
 
+	dependencyArtifacts map[string]BuildArtifact
+
 	debug         bool
 	force         bool
+	onError       string
 	l             sync.Mutex
 	prepareCalled bool
 }
@@ -120,12 +164,27 @@ func (b *coreBuild) Prepare() (warn []string, err error) {
 
 	b.prepareCalled = true
 
+	// The artifacts of the dependencies are sent as JSON, since their
+	// structure doesn't survive the trip to the plugins otherwise.
+	var buildArtifacts string
+	if len(b.dependencyArtifacts) > 0 {
+		encoded, err := json.Marshal(b.dependencyArtifacts)
+		if err != nil {
+			return nil, err
+		}
+
+		buildArtifacts = string(encoded)
+	}
+
 	packerConfig := map[string]interface{}{
-		BuildNameConfigKey:     b.name,
-		BuilderTypeConfigKey:   b.builderType,
-		DebugConfigKey:         b.debug,
-		ForceConfigKey:         b.force,
-		UserVariablesConfigKey: b.variables,
+		BuildArtifactsConfigKey: buildArtifacts,
+		BuildNameConfigKey:      b.name,
+		BuilderTypeConfigKey:    b.builderType,
+		DebugConfigKey:          b.debug,
+		ForceConfigKey:          b.force,
+		OnErrorConfigKey:        b.onError,
+		TemplatePathConfigKey:   b.templatePath,
+		UserVariablesConfigKey:  b.variables,
 	}
 
 	// Prepare the builder
@@ -301,6 +360,30 @@ func (b *coreBuild) SetForce(val bool) {
 	b.force = val
 }
 
+func (b *coreBuild) SetOnError(val string) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	b.onError = val
+}
+
+func (b *coreBuild) DependsOn() []string {
+	return b.dependsOn
+}
+
+func (b *coreBuild) SetDependencyArtifact(name string, artifact BuildArtifact) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	if b.dependencyArtifacts == nil {
+		b.dependencyArtifacts = make(map[string]BuildArtifact)
+	}
+
+	b.dependencyArtifacts[name] = artifact
+}
+
 // Cancels the build if it is running.
 func (b *coreBuild) Cancel() {
 	b.builder.Cancel()
@@ -0,0 +1,150 @@
+package packer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BuildArtifact describes the artifacts of a build to the builds that
+// depend on it. Templates of those builds can access it with the "build"
+// function.
+type BuildArtifact struct {
+	// BuilderId, Id and String are those of the first artifact of
+	// the build.
+	BuilderId string
+	Id        string
+	String    string
+
+	// Files are the files of all the artifacts of the build.
+	Files []string
+}
+
+// NewBuildArtifact describes the artifacts that a build resulted in.
+func NewBuildArtifact(artifacts []Artifact) BuildArtifact {
+	var result BuildArtifact
+	result.Files = make([]string, 0)
+	for _, a := range artifacts {
+		if a == nil {
+			continue
+		}
+
+		if result.BuilderId == "" {
+			result.BuilderId = a.BuilderId()
+			result.Id = a.Id()
+			result.String = a.String()
+		}
+
+		result.Files = append(result.Files, a.Files()...)
+	}
+
+	return result
+}
+
+// field returns the value of a field of the artifact for the "build"
+// template function.
+func (a *BuildArtifact) field(name string, args ...string) (string, error) {
+	switch name {
+	case "builder_id":
+		return a.BuilderId, nil
+	case "id":
+		return a.Id, nil
+	case "string":
+		return a.String, nil
+	case "files":
+		return strings.Join(a.Files, ","), nil
+	case "file":
+		if len(args) != 1 {
+			return "", fmt.Errorf("'file' requires the suffix of the file to find")
+		}
+
+		for _, f := range a.Files {
+			if strings.HasSuffix(f, args[0]) {
+				return f, nil
+			}
+		}
+
+		return "", fmt.Errorf("no artifact file ending in '%s'", args[0])
+	}
+
+	return "", fmt.Errorf(
+		"unknown artifact field '%s'. Must be one of: builder_id, id, string, files, file", name)
+}
+
+// checkBuildDependencies verifies that the builders only depend on other
+// builders of the template and that there are no cycles.
+func checkBuildDependencies(builders map[string]RawBuilderConfig) []error {
+	errs := make([]error, 0)
+
+	names := make([]string, 0, len(builders))
+	for name := range builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, dep := range builders[name].DependsOn {
+			if dep == name {
+				errs = append(errs, fmt.Errorf(
+					"builder '%s' can't depend on itself", name))
+			} else if _, ok := builders[dep]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"builder '%s' depends on unknown builder '%s'", name, dep))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// Depth first search for cycles, remembering the path so that the
+	// cycle can be shown.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	var path []string
+	var visit func(string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+				}
+			}
+
+			cycle := append(path[start:], name)
+			return fmt.Errorf(
+				"builders have a dependency cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range builders[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+
+	return errs
+}
@@ -28,11 +28,14 @@ func testBuild() *coreBuild {
 
 func testDefaultPackerConfig() map[string]interface{} {
 	return map[string]interface{}{
-		BuildNameConfigKey:     "test",
-		BuilderTypeConfigKey:   "foo",
-		DebugConfigKey:         false,
-		ForceConfigKey:         false,
-		UserVariablesConfigKey: make(map[string]string),
+		BuildArtifactsConfigKey: "",
+		BuildNameConfigKey:      "test",
+		BuilderTypeConfigKey:    "foo",
+		DebugConfigKey:          false,
+		ForceConfigKey:          false,
+		OnErrorConfigKey:        "",
+		TemplatePathConfigKey:   "",
+		UserVariablesConfigKey:  make(map[string]string),
 	}
 }
 func TestBuild_Name(t *testing.T) {
@@ -115,6 +118,40 @@ func TestBuildPrepare_BuilderWarniings(t *testing.T) {
 	}
 }
 
+func TestBuild_Prepare_DependencyArtifacts(t *testing.T) {
+	packerConfig := testDefaultPackerConfig()
+	packerConfig[BuildArtifactsConfigKey] =
+		`{"base":{"BuilderId":"bid","Id":"foo","String":"","Files":["a.vmx"]}}`
+
+	build := testBuild()
+	builder := build.builder.(*MockBuilder)
+
+	build.SetDependencyArtifact("base", BuildArtifact{
+		BuilderId: "bid",
+		Id:        "foo",
+		Files:     []string{"a.vmx"},
+	})
+
+	build.Prepare()
+	if !reflect.DeepEqual(builder.PrepareConfig, []interface{}{42, packerConfig}) {
+		t.Fatalf("bad: %#v", builder.PrepareConfig)
+	}
+}
+
+func TestBuild_Prepare_OnError(t *testing.T) {
+	packerConfig := testDefaultPackerConfig()
+	packerConfig[OnErrorConfigKey] = OnErrorAbort
+
+	build := testBuild()
+	builder := build.builder.(*MockBuilder)
+
+	build.SetOnError(OnErrorAbort)
+	build.Prepare()
+	if !reflect.DeepEqual(builder.PrepareConfig, []interface{}{42, packerConfig}) {
+		t.Fatalf("bad: %#v", builder.PrepareConfig)
+	}
+}
+
 func TestBuild_Prepare_Debug(t *testing.T) {
 	packerConfig := testDefaultPackerConfig()
 	packerConfig[DebugConfigKey] = true
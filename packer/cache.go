@@ -3,11 +3,16 @@ package packer
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"github.com/mitchellh/packer/common/filelock"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Cache implements a caching interface where files can be stored for
@@ -37,12 +42,38 @@ type Cache interface {
 	RUnlock(string)
 }
 
+// ChecksumKey returns a cache key that addresses a file by its checksum
+// instead of by where it came from, so that the same file fetched from
+// different URLs is only cached once. The extension of name, usually the
+// URL of the file, is kept so that the cached file has it too.
+func ChecksumKey(checksumType string, checksum string, name string) string {
+	if endIndex := strings.Index(name, "?"); endIndex > -1 {
+		name = name[:endIndex]
+	}
+
+	return fmt.Sprintf("checksum:%s:%s%s",
+		strings.ToLower(checksumType), strings.ToLower(checksum), filepath.Ext(name))
+}
+
 // FileCache implements a Cache by caching the data directly to a cache
 // directory.
+//
+// Keys are locked within the process with mutexes and across processes
+// with a lock on a ".lock" file next to the cached file, so that several
+// Packer processes can share a cache directory.
 type FileCache struct {
 	CacheDir string
 	l        sync.Mutex
 	rw       map[string]*sync.RWMutex
+	files    map[string][]*os.File
+}
+
+// CacheEntry is a file stored in a FileCache. ModTime is when the file
+// was last used, since locking a key touches its file.
+type CacheEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
 }
 
 func (f *FileCache) Lock(key string) string {
@@ -50,11 +81,16 @@ func (f *FileCache) Lock(key string) string {
 	rw := f.rwLock(hashKey)
 	rw.Lock()
 
-	return f.cachePath(key, hashKey)
+	path := f.cachePath(key, hashKey)
+	f.fileLock(hashKey, path, true)
+	f.touch(path)
+	return path
 }
 
 func (f *FileCache) Unlock(key string) {
 	hashKey := f.hashKey(key)
+	f.fileUnlock(hashKey)
+
 	rw := f.rwLock(hashKey)
 	rw.Unlock()
 }
@@ -64,15 +100,184 @@ func (f *FileCache) RLock(key string) (string, bool) {
 	rw := f.rwLock(hashKey)
 	rw.RLock()
 
-	return f.cachePath(key, hashKey), true
+	path := f.cachePath(key, hashKey)
+	f.fileLock(hashKey, path, false)
+	f.touch(path)
+	return path, true
 }
 
 func (f *FileCache) RUnlock(key string) {
 	hashKey := f.hashKey(key)
+	f.fileUnlock(hashKey)
+
 	rw := f.rwLock(hashKey)
 	rw.RUnlock()
 }
 
+// Entries returns the files in the cache, least recently used first.
+func (f *FileCache) Entries() ([]*CacheEntry, error) {
+	infos, err := ioutil.ReadDir(f.CacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	result := make([]*CacheEntry, 0, len(infos))
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || strings.HasSuffix(info.Name(), ".lock") {
+			continue
+		}
+
+		result = append(result, &CacheEntry{
+			Path:    filepath.Join(f.CacheDir, info.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	sort.Sort(cacheEntriesByAge(result))
+	return result, nil
+}
+
+// Prune removes the entries not used within maxAge, and then the least
+// recently used entries until the cache is no bigger than maxSize bytes. A zero maxAge
+// or maxSize means no limit. Entries that are locked, by this or any other
+// process, are left alone. The removed entries are returned.
+func (f *FileCache) Prune(maxAge time.Duration, maxSize int64) ([]*CacheEntry, error) {
+	entries, err := f.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	now := time.Now()
+	removed := make([]*CacheEntry, 0)
+	for _, e := range entries {
+		expired := maxAge > 0 && now.Sub(e.ModTime) > maxAge
+		tooBig := maxSize > 0 && total > maxSize
+		if !expired && !tooBig {
+			continue
+		}
+
+		ok, err := f.removeEntry(e)
+		if err != nil {
+			return removed, err
+		}
+
+		if ok {
+			removed = append(removed, e)
+			total -= e.Size
+		}
+	}
+
+	return removed, nil
+}
+
+// removeEntry removes the cached file and its lock file if nobody holds
+// a lock on it. It returns whether the file was removed.
+func (f *FileCache) removeEntry(e *CacheEntry) (bool, error) {
+	lockPath := e.Path + ".lock"
+	lf, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer lf.Close()
+
+	if err := filelock.Lock(lf, true, false); err != nil {
+		log.Printf("Cache entry is in use, not removing: %s (%s)", e.Path, err)
+		return false, nil
+	}
+	defer filelock.Unlock(lf)
+
+	if err := os.Remove(e.Path); err != nil {
+		return false, err
+	}
+
+	// Whoever waits on the removed lock file notices that it is gone
+	// once they get the lock, and locks a new one instead.
+	if err := os.Remove(lockPath); err != nil {
+		log.Printf("[WARN] Error removing cache lock file: %s", err)
+	}
+
+	return true, nil
+}
+
+// fileLock locks the lock file of a cached file for other processes. The
+// in-process lock of the key must already be held. Errors are only logged,
+// since the in-process lock still protects the file within this process.
+func (f *FileCache) fileLock(hashKey string, path string, exclusive bool) {
+	var lf *os.File
+	for {
+		var err error
+		lf, err = os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			log.Printf("[ERR] Error opening cache lock file: %s", err)
+			return
+		}
+
+		if err := filelock.Lock(lf, exclusive, true); err != nil {
+			log.Printf("[ERR] Error locking cache lock file: %s", err)
+			lf.Close()
+			return
+		}
+
+		// Prune removes the lock file together with the cached file, so
+		// the lock only counts if the lock file is still there.
+		lfi, err := lf.Stat()
+		if err != nil {
+			break
+		}
+		if fi, err := os.Stat(path + ".lock"); err == nil && os.SameFile(lfi, fi) {
+			break
+		}
+
+		filelock.Unlock(lf)
+		lf.Close()
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if f.files == nil {
+		f.files = make(map[string][]*os.File)
+	}
+
+	f.files[hashKey] = append(f.files[hashKey], lf)
+}
+
+// touch sets the modification time of the cached file, if it exists, to
+// now so that Prune can tell how recently it was used.
+func (f *FileCache) touch(path string) {
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil && !os.IsNotExist(err) {
+		log.Printf("[WARN] Error updating time of cached file: %s", err)
+	}
+}
+
+// fileUnlock releases one of the lock files held for the key.
+func (f *FileCache) fileUnlock(hashKey string) {
+	f.l.Lock()
+	files := f.files[hashKey]
+	if len(files) == 0 {
+		f.l.Unlock()
+		return
+	}
+
+	lf := files[len(files)-1]
+	f.files[hashKey] = files[:len(files)-1]
+	f.l.Unlock()
+
+	filelock.Unlock(lf)
+	lf.Close()
+}
+
 func (f *FileCache) cachePath(key string, hashKey string) string {
 	if endIndex := strings.Index(key, "?"); endIndex > -1 {
 		key = key[:endIndex]
@@ -102,6 +307,12 @@ func (f *FileCache) hashKey(key string) string {
 	return hex.EncodeToString(sha.Sum(nil))
 }
 
+type cacheEntriesByAge []*CacheEntry
+
+func (s cacheEntriesByAge) Len() int           { return len(s) }
+func (s cacheEntriesByAge) Less(i, j int) bool { return s[i].ModTime.Before(s[j].ModTime) }
+func (s cacheEntriesByAge) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 func (f *FileCache) rwLock(hashKey string) *sync.RWMutex {
 	f.l.Lock()
 	defer f.l.Unlock()
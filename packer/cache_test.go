@@ -1,10 +1,13 @@
 package packer
 
 import (
+	"github.com/mitchellh/packer/common/filelock"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 type TestCache struct{}
@@ -80,3 +83,189 @@ func TestFileCache(t *testing.T) {
 		t.Fatalf("unknown data: %s", data)
 	}
 }
+
+func TestFileCache_crossProcessLock(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cache := &FileCache{CacheDir: cacheDir}
+	path := cache.Lock("foo.iso")
+
+	// Another open file stands in for another process
+	lf, err := os.OpenFile(path+".lock", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer lf.Close()
+
+	if err := filelock.Lock(lf, false, false); err == nil {
+		t.Fatal("should not be able to lock while write locked")
+	}
+
+	cache.Unlock("foo.iso")
+
+	cache.RLock("foo.iso")
+	if err := filelock.Lock(lf, false, false); err != nil {
+		t.Fatalf("should be able to share a read lock: %s", err)
+	}
+	filelock.Unlock(lf)
+
+	if err := filelock.Lock(lf, true, false); err == nil {
+		t.Fatal("should not be able to write lock while read locked")
+	}
+
+	cache.RUnlock("foo.iso")
+	if err := filelock.Lock(lf, true, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	filelock.Unlock(lf)
+}
+
+func TestFileCache_Prune(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cache := &FileCache{CacheDir: cacheDir}
+
+	// Three files of 10 bytes, one, two and three days old
+	now := time.Now()
+	paths := make([]string, 3)
+	for i, key := range []string{"a.iso", "b.iso", "c.iso"} {
+		paths[i] = cache.Lock(key)
+		if err := ioutil.WriteFile(paths[i], make([]byte, 10), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		cache.Unlock(key)
+
+		mtime := now.Add(-time.Duration(i+1) * 24 * time.Hour)
+		if err := os.Chtimes(paths[i], mtime, mtime); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 3 || entries[0].Path != paths[2] || entries[0].Size != 10 {
+		t.Fatalf("bad: %#v", entries)
+	}
+
+	// Nothing is older than a week
+	removed, err := cache.Prune(7*24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("bad: %#v", removed)
+	}
+
+	// Prune by age
+	removed, err = cache.Prune(60*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(removed) != 1 || removed[0].Path != paths[2] {
+		t.Fatalf("bad: %#v", removed)
+	}
+	if _, err := os.Stat(paths[2] + ".lock"); !os.IsNotExist(err) {
+		t.Fatal("lock file should be removed")
+	}
+
+	// Prune by size, skipping the locked oldest file. Locking marks the
+	// file as used, so set its time back.
+	cache.RLock("b.iso")
+	mtime := now.Add(-3 * 24 * time.Hour)
+	if err := os.Chtimes(paths[1], mtime, mtime); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	removed, err = cache.Prune(0, 10)
+	cache.RUnlock("b.iso")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(removed) != 1 || removed[0].Path != paths[0] {
+		t.Fatalf("bad: %#v", removed)
+	}
+
+	entries, err = cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 1 || filepath.Base(entries[0].Path) != filepath.Base(paths[1]) {
+		t.Fatalf("bad: %#v", entries)
+	}
+}
+
+func TestFileCache_lockTouches(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cache := &FileCache{CacheDir: cacheDir}
+	path := cache.Lock("foo.iso")
+	if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cache.Unlock("foo.iso")
+
+	mtime := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A cache hit counts as a use of the file
+	cache.RLock("foo.iso")
+	cache.RUnlock("foo.iso")
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if time.Since(fi.ModTime()) > time.Hour {
+		t.Fatalf("bad: %s", fi.ModTime())
+	}
+
+	// Pruning doesn't leave the lock file behind, and the key can still
+	// be locked afterwards
+	removed, err := cache.Prune(0, 1)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("bad: %#v", removed)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatal("lock file should be removed")
+	}
+
+	cache.Lock("foo.iso")
+	cache.Unlock("foo.iso")
+	if _, err := os.Stat(path + ".lock"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestChecksumKey(t *testing.T) {
+	a := ChecksumKey("md5", "ABCD", "http://example.com/foo.iso?x=y")
+	b := ChecksumKey("MD5", "abcd", "ftp://mirror/pub/bar.iso")
+	if a != b {
+		t.Fatalf("keys should be equal: %s %s", a, b)
+	}
+
+	if !strings.HasSuffix(a, ".iso") {
+		t.Fatalf("bad: %s", a)
+	}
+
+	if a == ChecksumKey("sha1", "abcd", "foo.iso") {
+		t.Fatal("keys of different checksum types should differ")
+	}
+}
@@ -7,6 +7,12 @@ import (
 	"sync"
 )
 
+// CmdDisconnect is the exit status of a RemoteCmd with ReportDisconnect
+// set whose connection to the machine was lost before the command exited,
+// for example because the command rebooted the machine. Its real exit
+// status is unknown.
+const CmdDisconnect int = 2300218
+
 // RemoteCmd represents a remote command being prepared or run.
 type RemoteCmd struct {
 	// Command is the command to run remotely. This is executed as if
@@ -25,16 +31,23 @@ type RemoteCmd struct {
 	Stdout io.Writer
 	Stderr io.Writer
 
+	// If true, the exit status is CmdDisconnect if the connection is lost
+	// while the command runs. Otherwise, for compatibility with callers
+	// that only check for a non-zero exit status, it is 0.
+	ReportDisconnect bool
+
 	// This will be set to true when the remote command has exited. It
 	// shouldn't be set manually by the user, but there is no harm in
 	// doing so.
 	Exited bool
 
 	// Once Exited is true, this will contain the exit code of the process.
+	// See ReportDisconnect for commands whose connection is lost.
 	ExitStatus int
 
 	// Internal fields
-	exitCh chan struct{}
+	exitCh  chan struct{}
+	abortFn func()
 
 	// This thing is a mutex, lock when making modifications concurrently
 	sync.Mutex
@@ -73,6 +86,15 @@ type Communicator interface {
 	// with the contents writing to the given writer. This method will
 	// block until it completes.
 	Download(string, io.Writer) error
+
+	// DownloadDir downloads the contents of a remote directory recursively
+	// to the local path. It also takes an optional slice of paths to
+	// ignore when downloading.
+	//
+	// The trailing slash semantics are the same as UploadDir: "/tmp/src"
+	// as the source will create a "src" directory in the destination
+	// unless a trailing slash is added.
+	DownloadDir(src string, dst string, exclude []string) error
 }
 
 // StartWithUi runs the remote command and streams the output to any
@@ -168,6 +190,32 @@ func (r *RemoteCmd) SetExited(status int) {
 	close(r.exitCh)
 }
 
+// SetAbort sets the function that Abort calls to stop the command, for
+// example by closing its session. Communicators that are able to stop a
+// running command call this in Start.
+func (r *RemoteCmd) SetAbort(f func()) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.abortFn = f
+}
+
+// Abort stops the running command if its communicator supports it,
+// returning whether it does. The communicator still marks the command as
+// exited once it stops.
+func (r *RemoteCmd) Abort() bool {
+	r.Lock()
+	f := r.abortFn
+	r.Unlock()
+
+	if f == nil {
+		return false
+	}
+
+	f()
+	return true
+}
+
 // Wait waits for the remote command to complete.
 func (r *RemoteCmd) Wait() {
 	// Make sure our condition variable is initialized.
@@ -42,6 +42,33 @@ func TestRemoteCmd_StartWithUi(t *testing.T) {
 	}
 }
 
+func TestRemoteCmd_StartWithUiSensitive(t *testing.T) {
+	LogSecretFilter.Set("hunter2")
+	defer func() { LogSecretFilter.secrets = nil }()
+
+	uiOutput := new(bytes.Buffer)
+	testComm := new(MockCommunicator)
+	testComm.StartStdout = "the password is hunter2\n"
+	testComm.StartStderr = "hunter2"
+	testUi := &BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: uiOutput,
+	}
+
+	rc := &RemoteCmd{Command: "test"}
+	if err := rc.StartWithUi(testComm, testUi); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Contains(uiOutput.String(), "hunter2") {
+		t.Fatalf("bad output: '%s'", uiOutput.String())
+	}
+
+	if !strings.Contains(uiOutput.String(), "the password is <sensitive>") {
+		t.Fatalf("bad output: '%s'", uiOutput.String())
+	}
+}
+
 func TestRemoteCmd_Wait(t *testing.T) {
 	var cmd RemoteCmd
 
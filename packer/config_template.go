@@ -2,10 +2,17 @@ package packer
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/mitchellh/packer/common/uuid"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
 )
@@ -25,6 +32,19 @@ func init() {
 type ConfigTemplate struct {
 	UserVars map[string]string
 
+	// BuildName and BuildType are the name of the build and the type of
+	// its builder, exposed as "build_name" and "build_type".
+	BuildName string
+	BuildType string
+
+	// TemplatePath is the path to the template file being processed, if
+	// it came from a file. Its directory is exposed as "template_dir".
+	TemplatePath string
+
+	// BuildArtifacts are the artifacts of the builds that the build
+	// depends on, by build name, exposed with "build".
+	BuildArtifacts map[string]BuildArtifact
+
 	root *template.Template
 	i    int
 }
@@ -37,12 +57,25 @@ func NewConfigTemplate() (*ConfigTemplate, error) {
 
 	result.root = template.New("configTemplateRoot")
 	result.root.Funcs(template.FuncMap{
-		"env":       templateDisableEnv,
-		"pwd":       templatePwd,
-		"isotime":   templateISOTime,
-		"timestamp": templateTimestamp,
-		"user":      result.templateUser,
-		"uuid":      templateUuid,
+		"build":        result.templateBuild,
+		"build_name":   result.templateBuildName,
+		"build_type":   result.templateBuildType,
+		"env":          templateDisableEnv,
+		"file":         templateFile,
+		"isotime":      templateISOTime,
+		"join":         templateJoin,
+		"lower":        strings.ToLower,
+		"md5":          templateMD5,
+		"pwd":          templatePwd,
+		"replace":      templateReplace,
+		"sha256":       templateSHA256,
+		"split":        templateSplit,
+		"template_dir": result.templateDir,
+		"timestamp":    templateTimestamp,
+		"trim":         strings.TrimSpace,
+		"upper":        strings.ToUpper,
+		"user":         result.templateUser,
+		"uuid":         templateUuid,
 	})
 
 	return result, nil
@@ -96,6 +129,45 @@ func (t *ConfigTemplate) templateUser(n string) (string, error) {
 	return result, nil
 }
 
+// templateBuild returns a field of the artifact of a build that this
+// build depends on, such as {{build "base" "id"}}.
+func (t *ConfigTemplate) templateBuild(name, field string, args ...string) (string, error) {
+	artifact, ok := t.BuildArtifacts[name]
+	if !ok {
+		return "", fmt.Errorf(
+			"artifact of build '%s' isn't available. Add it to depends_on "+
+				"of this builder to use it.", name)
+	}
+
+	return artifact.field(field, args...)
+}
+
+func (t *ConfigTemplate) templateBuildName() (string, error) {
+	if t.BuildName == "" {
+		return "", errors.New("build_name is only available within a build")
+	}
+
+	return t.BuildName, nil
+}
+
+func (t *ConfigTemplate) templateBuildType() (string, error) {
+	if t.BuildType == "" {
+		return "", errors.New("build_type is only available within a build")
+	}
+
+	return t.BuildType, nil
+}
+
+// templateDir returns the absolute path to the directory of the template,
+// or the working directory if the template wasn't read from a file.
+func (t *ConfigTemplate) templateDir() (string, error) {
+	if t.TemplatePath == "" {
+		return os.Getwd()
+	}
+
+	return filepath.Abs(filepath.Dir(t.TemplatePath))
+}
+
 func templateDisableEnv(n string) (string, error) {
 	return "", fmt.Errorf(
 		"Environmental variables can only be used as default values for user variables.")
@@ -110,14 +182,56 @@ func templateEnv(n string) string {
 	return os.Getenv(n)
 }
 
-func templateISOTime() string {
-	return InitTime.Format(time.RFC3339)
+func templateFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return string(contents), nil
+}
+
+// templateISOTime formats the time with the given layout in the format of
+// the time package, such as "2006-01-02". The default is RFC-3339.
+func templateISOTime(layout ...string) (string, error) {
+	switch len(layout) {
+	case 0:
+		return InitTime.Format(time.RFC3339), nil
+	case 1:
+		return InitTime.Format(layout[0]), nil
+	}
+
+	return "", errors.New("isotime takes at most one format argument")
+}
+
+func templateJoin(sep string, elems []string) string {
+	return strings.Join(elems, sep)
+}
+
+func templateMD5(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
 }
 
 func templatePwd() (string, error) {
 	return os.Getwd()
 }
 
+// templateReplace takes the string last so that it can be used in a
+// pipeline, like the rest of the string functions.
+func templateReplace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+func templateSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func templateSplit(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
 func templateTimestamp() string {
 	return strconv.FormatInt(InitTime.Unix(), 10)
 }
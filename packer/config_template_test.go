@@ -1,8 +1,10 @@
 package packer
 
 import (
+	"io/ioutil"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -20,6 +22,137 @@ func TestConfigTemplateProcess_env(t *testing.T) {
 	}
 }
 
+func TestConfigTemplateProcess_buildArtifact(t *testing.T) {
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := tpl.Process(`{{build "base" "id"}}`, nil); err == nil {
+		t.Fatal("should error without the artifact")
+	}
+
+	tpl.BuildArtifacts = map[string]BuildArtifact{
+		"base": NewBuildArtifact([]Artifact{
+			&MockArtifact{IdValue: "foo", FilesValue: []string{"a.vmdk", "a.vmx"}},
+		}),
+	}
+
+	cases := map[string]string{
+		`{{build "base" "id"}}`:          "foo",
+		`{{build "base" "builder_id"}}`:  "bid",
+		`{{build "base" "files"}}`:       "a.vmdk,a.vmx",
+		`{{build "base" "file" ".vmx"}}`: "a.vmx",
+	}
+
+	for input, expected := range cases {
+		result, err := tpl.Process(input, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if result != expected {
+			t.Fatalf("bad: %s => %s", input, result)
+		}
+	}
+
+	errCases := []string{
+		`{{build "base" "nope"}}`,
+		`{{build "base" "file"}}`,
+		`{{build "base" "file" ".ovf"}}`,
+	}
+
+	for _, input := range errCases {
+		if _, err := tpl.Process(input, nil); err == nil {
+			t.Fatalf("should error: %s", input)
+		}
+	}
+}
+
+func TestConfigTemplateProcess_build(t *testing.T) {
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := tpl.Process(`{{build_name}}`, nil); err == nil {
+		t.Fatal("should error outside of a build")
+	}
+
+	tpl.BuildName = "foo"
+	tpl.BuildType = "bar"
+
+	result, err := tpl.Process(`{{build_name}}-{{build_type}}`, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != "foo-bar" {
+		t.Fatalf("bad: %s", result)
+	}
+}
+
+func TestConfigTemplateProcess_file(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+	tf.Write([]byte("hello\n"))
+	tf.Close()
+
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tpl.UserVars["path"] = tf.Name()
+
+	result, err := tpl.Process(`{{file (user "path") | trim}}`, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != "hello" {
+		t.Fatalf("bad: %s", result)
+	}
+
+	result, err = tpl.Process(`{{file (user "path") | md5}}`, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != "b1946ac92492d2347c6235b4d2611184" {
+		t.Fatalf("bad: %s", result)
+	}
+
+	if _, err := tpl.Process(`{{file "/i/dont/exist"}}`, nil); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestConfigTemplateProcess_hash(t *testing.T) {
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := map[string]string{
+		`{{md5 "foo"}}`:    "acbd18db4cc2f85cedef654fccc4a4d8",
+		`{{sha256 "foo"}}`: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+	}
+
+	for input, expected := range cases {
+		result, err := tpl.Process(input, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if result != expected {
+			t.Fatalf("bad: %s => %s", input, result)
+		}
+	}
+}
+
 func TestConfigTemplateProcess_isotime(t *testing.T) {
 	tpl, err := NewConfigTemplate()
 	if err != nil {
@@ -42,6 +175,26 @@ func TestConfigTemplateProcess_isotime(t *testing.T) {
 	}
 }
 
+func TestConfigTemplateProcess_isotimeFormat(t *testing.T) {
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := tpl.Process(`{{isotime "2006-01-02"}}`, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != InitTime.Format("2006-01-02") {
+		t.Fatalf("bad: %s", result)
+	}
+
+	if _, err := tpl.Process(`{{isotime "a" "b"}}`, nil); err == nil {
+		t.Fatal("should error")
+	}
+}
+
 func TestConfigTemplateProcess_pwd(t *testing.T) {
 	tpl, err := NewConfigTemplate()
 	if err != nil {
@@ -63,6 +216,64 @@ func TestConfigTemplateProcess_pwd(t *testing.T) {
 	}
 }
 
+func TestConfigTemplateProcess_strings(t *testing.T) {
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tpl.UserVars["foo"] = " Foo,Bar "
+
+	cases := map[string]string{
+		`{{user "foo" | lower}}`:                       " foo,bar ",
+		`{{user "foo" | upper}}`:                       " FOO,BAR ",
+		`{{user "foo" | trim}}`:                        "Foo,Bar",
+		`{{user "foo" | replace "Bar" "Baz"}}`:         " Foo,Baz ",
+		`{{user "foo" | trim | split "," | join "-"}}`: "Foo-Bar",
+	}
+
+	for input, expected := range cases {
+		result, err := tpl.Process(input, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if result != expected {
+			t.Fatalf("bad: %s => %#v", input, result)
+		}
+	}
+}
+
+func TestConfigTemplateProcess_templateDir(t *testing.T) {
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := tpl.Process(`{{template_dir}}`, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != pwd {
+		t.Fatalf("bad: %s", result)
+	}
+
+	tpl.TemplatePath = filepath.Join("foo", "template.json")
+	result, err = tpl.Process(`{{template_dir}}`, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != filepath.Join(pwd, "foo") {
+		t.Fatalf("bad: %s", result)
+	}
+}
+
 func TestConfigTemplateProcess_timestamp(t *testing.T) {
 	tpl, err := NewConfigTemplate()
 	if err != nil {
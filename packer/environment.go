@@ -202,7 +202,7 @@ func (e *coreEnvironment) Provisioner(name string) (p Provisioner, err error) {
 // Executes a command as if it was typed on the command-line interface.
 // The return value is the exit code of the command.
 func (e *coreEnvironment) Cli(args []string) (result int, err error) {
-	log.Printf("Environment.Cli: %#v\n", args)
+	log.Printf("Environment.Cli: %#v\n", maskVarArgs(args))
 
 	// If we have no arguments, just short-circuit here and print the help
 	if len(args) == 0 {
@@ -228,7 +228,7 @@ func (e *coreEnvironment) Cli(args []string) (result int, err error) {
 		}
 	}
 
-	log.Printf("command + args: %#v", args)
+	log.Printf("command + args: %#v", maskVarArgs(args))
 
 	version := args[0] == "version"
 	if !version {
@@ -357,3 +357,57 @@ func (e *coreEnvironment) printHelp() {
 func (e *coreEnvironment) Ui() Ui {
 	return e.ui
 }
+
+// maskVarArgs returns a copy of the command-line arguments with the values
+// of -var and -var-file masked, for logging. The sensitive variables are
+// only known once the template is parsed, which is after the arguments
+// are logged.
+func maskVarArgs(args []string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+
+	for i := 0; i < len(result); i++ {
+		name := strings.TrimLeft(result[i], "-")
+		if len(name) == len(result[i]) {
+			continue
+		}
+
+		value := ""
+		if idx := strings.Index(name, "="); idx > -1 {
+			name, value = name[:idx], name[idx+1:]
+		} else if name == "var" || name == "var-file" {
+			// The value is the next argument
+			i++
+			if i >= len(result) {
+				break
+			}
+
+			value = result[i]
+		}
+
+		var masked string
+		switch name {
+		case "var":
+			// Keep the name of the variable, which is useful to see
+			if idx := strings.Index(value, "="); idx > -1 {
+				masked = value[:idx+1] + SensitiveMask
+			} else {
+				masked = SensitiveMask
+			}
+		case "var-file":
+			masked = SensitiveMask
+		default:
+			continue
+		}
+
+		if strings.HasPrefix(result[i], "-") {
+			// The value was part of the flag, as in -var=foo=bar
+			dashes := result[i][:len(result[i])-len(strings.TrimLeft(result[i], "-"))]
+			result[i] = dashes + name + "=" + masked
+		} else {
+			result[i] = masked
+		}
+	}
+
+	return result
+}
@@ -429,3 +429,26 @@ func TestEnvironment_SettingUi(t *testing.T) {
 		t.Fatalf("UI should be equal: %#v", env.Ui())
 	}
 }
+
+func TestMaskVarArgs(t *testing.T) {
+	args := []string{
+		"build", "-var", "password=secret", "-var=token=abc",
+		"--var-file", "secrets.json", "-var-file=other.json",
+		"-force", "template.json",
+	}
+
+	expected := []string{
+		"build", "-var", "password=<sensitive>", "-var=token=<sensitive>",
+		"--var-file", "<sensitive>", "-var-file=<sensitive>",
+		"-force", "template.json",
+	}
+
+	actual := maskVarArgs(args)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if args[2] != "password=secret" {
+		t.Fatal("should not modify the arguments")
+	}
+}
@@ -1,7 +1,10 @@
 package packer
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"sync"
 	"time"
 )
@@ -144,3 +147,354 @@ func (p *PausedProvisioner) Cancel() {
 func (p *PausedProvisioner) provision(result chan<- error, ui Ui, comm Communicator) {
 	result <- p.Provisioner.Provision(ui, comm)
 }
+
+// provisionAbortWait is how long a cancelled or timed out provisioner is
+// given to return before it is abandoned, so that a stuck provisioner
+// can't hang the build.
+var provisionAbortWait = 1 * time.Minute
+
+// cancellableProvision is embedded by the provisioner wrappers below to
+// track the running Provision call, so that Cancel can interrupt it and
+// wait for it to return.
+type cancellableProvision struct {
+	cancelCh chan struct{}
+	doneCh   chan struct{}
+	lock     sync.Mutex
+}
+
+// begin is called when Provision starts. It returns a channel that is
+// closed when Cancel is called, and a function to call when Provision
+// returns.
+func (c *cancellableProvision) begin() (<-chan struct{}, func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cancelCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	c.cancelCh = cancelCh
+	c.doneCh = doneCh
+
+	return cancelCh, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if c.cancelCh == cancelCh {
+			c.cancelCh = nil
+		}
+		if c.doneCh == doneCh {
+			c.doneCh = nil
+		}
+
+		close(doneCh)
+	}
+}
+
+func (c *cancellableProvision) Cancel() {
+	var doneCh chan struct{}
+
+	c.lock.Lock()
+	if c.cancelCh != nil {
+		close(c.cancelCh)
+		c.cancelCh = nil
+	}
+	if c.doneCh != nil {
+		doneCh = c.doneCh
+	}
+	c.lock.Unlock()
+
+	<-doneCh
+}
+
+// startProvision runs the provisioner in the background, returning the
+// channel that its result is sent on.
+func startProvision(p Provisioner, ui Ui, comm Communicator) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- p.Provision(ui, comm)
+	}()
+
+	return result
+}
+
+// waitProvision waits for a provisioner that was told to stop, giving up
+// after provisionAbortWait.
+func waitProvision(provDoneCh <-chan error) error {
+	select {
+	case err := <-provDoneCh:
+		return err
+	case <-time.After(provisionAbortWait):
+		return fmt.Errorf("Provisioner didn't stop within %s", provisionAbortWait)
+	}
+}
+
+// RetriedProvisioner is a Provisioner implementation that runs the
+// provisioner again if it fails, up to MaxRetries more times. The wait
+// between attempts starts at RetryBackoff and doubles after each retry.
+type RetriedProvisioner struct {
+	MaxRetries   int
+	RetryBackoff time.Duration
+	Provisioner  Provisioner
+
+	// NewProvisioner, if set, creates the provisioner used for each retry,
+	// which is prepared with the same configuration as Provisioner. This
+	// way a retry doesn't depend on the state that a failed or timed out
+	// attempt left behind.
+	NewProvisioner func() (Provisioner, error)
+
+	cancellableProvision
+	raws []interface{}
+}
+
+func (p *RetriedProvisioner) Prepare(raws ...interface{}) error {
+	p.raws = raws
+	return p.Provisioner.Prepare(raws...)
+}
+
+func (p *RetriedProvisioner) Provision(ui Ui, comm Communicator) error {
+	cancelCh, end := p.begin()
+	defer end()
+
+	attempts := p.MaxRetries + 1
+	backoff := p.RetryBackoff
+	prov := p.Provisioner
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && p.NewProvisioner != nil {
+			var err error
+			prov, err = p.NewProvisioner()
+			if err == nil {
+				err = prov.Prepare(p.raws...)
+			}
+			if err != nil {
+				return fmt.Errorf("Error preparing provisioner for retry: %s", err)
+			}
+		}
+
+		if attempts > 1 {
+			ui.Say(fmt.Sprintf("Provisioner attempt %d of %d...", attempt, attempts))
+		}
+
+		provDoneCh := startProvision(prov, ui, comm)
+
+		var err error
+		select {
+		case err = <-provDoneCh:
+		case <-cancelCh:
+			prov.Cancel()
+			return waitProvision(provDoneCh)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= attempts {
+			if attempts > 1 {
+				return fmt.Errorf("Provisioner failed after %d attempts: %s", attempts, err)
+			}
+
+			return err
+		}
+
+		ui.Error(fmt.Sprintf("Provisioner attempt %d of %d failed: %s", attempt, attempts, err))
+		if backoff > 0 {
+			ui.Say(fmt.Sprintf("Retrying in %s...", backoff))
+			select {
+			case <-time.After(backoff):
+			case <-cancelCh:
+				return err
+			}
+
+			backoff *= 2
+		}
+	}
+}
+
+// TimeoutProvisioner is a Provisioner implementation that stops the
+// provisioner if it doesn't finish within the timeout. The commands and
+// transfers that the provisioner runs on the machine are aborted, and the
+// provisioner is cancelled. It is abandoned if it still doesn't return.
+//
+// A cancelled provisioner plugin exits, so a RetriedProvisioner around
+// this should create a new provisioner for each retry.
+type TimeoutProvisioner struct {
+	Timeout     time.Duration
+	Provisioner Provisioner
+
+	cancellableProvision
+}
+
+func (p *TimeoutProvisioner) Prepare(raws ...interface{}) error {
+	return p.Provisioner.Prepare(raws...)
+}
+
+func (p *TimeoutProvisioner) Provision(ui Ui, comm Communicator) error {
+	cancelCh, end := p.begin()
+	defer end()
+
+	abortComm := newAbortableCommunicator(comm)
+	provDoneCh := startProvision(p.Provisioner, ui, abortComm)
+
+	select {
+	case err := <-provDoneCh:
+		return err
+	case <-cancelCh:
+		p.Provisioner.Cancel()
+		return waitProvision(provDoneCh)
+	case <-time.After(p.Timeout):
+		ui.Error(fmt.Sprintf(
+			"Provisioner timed out after %s, aborting its commands...", p.Timeout))
+		abortComm.abort()
+		p.Provisioner.Cancel()
+		if err := waitProvision(provDoneCh); err != nil {
+			log.Printf("Timed out provisioner stopped with: %s", err)
+		}
+
+		return fmt.Errorf("Provisioner timed out after %s", p.Timeout)
+	}
+}
+
+// errProvisionAborted is returned by an abortableCommunicator once it is
+// aborted.
+var errProvisionAborted = errors.New("Provisioner was aborted")
+
+// abortableCommunicator is a Communicator that can abort everything that
+// is run through it. Once aborted, running commands are stopped if their
+// communicator is able to and exit with CmdDisconnect, uploads and
+// downloads fail at their next read or write, and nothing new can be
+// started.
+type abortableCommunicator struct {
+	Communicator
+
+	abortCh chan struct{}
+	once    sync.Once
+}
+
+func newAbortableCommunicator(c Communicator) *abortableCommunicator {
+	return &abortableCommunicator{
+		Communicator: c,
+		abortCh:      make(chan struct{}),
+	}
+}
+
+func (c *abortableCommunicator) abort() {
+	c.once.Do(func() { close(c.abortCh) })
+}
+
+func (c *abortableCommunicator) aborted() bool {
+	select {
+	case <-c.abortCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *abortableCommunicator) Start(cmd *RemoteCmd) error {
+	if c.aborted() {
+		return errProvisionAborted
+	}
+
+	// The command is run as a copy, so that it can be marked as exited
+	// when it is aborted even if the real command never exits.
+	inner := &RemoteCmd{
+		Command:          cmd.Command,
+		Stdin:            cmd.Stdin,
+		Stdout:           cmd.Stdout,
+		Stderr:           cmd.Stderr,
+		ReportDisconnect: cmd.ReportDisconnect,
+	}
+
+	if err := c.Communicator.Start(inner); err != nil {
+		return err
+	}
+
+	go func() {
+		exitCh := make(chan struct{})
+		go func() {
+			inner.Wait()
+			close(exitCh)
+		}()
+
+		select {
+		case <-exitCh:
+			cmd.SetExited(inner.ExitStatus)
+		case <-c.abortCh:
+			if !inner.Abort() {
+				log.Printf("Communicator can't abort command, leaving it: %s", cmd.Command)
+			}
+
+			cmd.SetExited(CmdDisconnect)
+		}
+	}()
+
+	return nil
+}
+
+func (c *abortableCommunicator) Upload(path string, r io.Reader) error {
+	return c.run(func() error {
+		return c.Communicator.Upload(path, &abortReader{r, c})
+	})
+}
+
+func (c *abortableCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	return c.run(func() error {
+		return c.Communicator.UploadDir(dst, src, exclude)
+	})
+}
+
+func (c *abortableCommunicator) Download(path string, w io.Writer) error {
+	return c.run(func() error {
+		return c.Communicator.Download(path, &abortWriter{w, c})
+	})
+}
+
+func (c *abortableCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	return c.run(func() error {
+		return c.Communicator.DownloadDir(src, dst, exclude)
+	})
+}
+
+// run runs a transfer, failing it if it is aborted. The transfer itself
+// is run in the calling goroutine, so that nothing is left running once
+// run returns.
+func (c *abortableCommunicator) run(f func() error) error {
+	if c.aborted() {
+		return errProvisionAborted
+	}
+
+	err := f()
+	if c.aborted() {
+		return errProvisionAborted
+	}
+
+	return err
+}
+
+// abortReader is an io.Reader that fails once the communicator is
+// aborted, which stops the upload reading from it.
+type abortReader struct {
+	io.Reader
+	c *abortableCommunicator
+}
+
+func (r *abortReader) Read(p []byte) (int, error) {
+	if r.c.aborted() {
+		return 0, errProvisionAborted
+	}
+
+	return r.Reader.Read(p)
+}
+
+// abortWriter is an io.Writer that fails once the communicator is
+// aborted, which stops the download writing to it.
+type abortWriter struct {
+	io.Writer
+	c *abortableCommunicator
+}
+
+func (w *abortWriter) Write(p []byte) (int, error) {
+	if w.c.aborted() {
+		return 0, errProvisionAborted
+	}
+
+	return w.Writer.Write(p)
+}
@@ -1,6 +1,12 @@
 package packer
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -171,3 +177,283 @@ func TestPausedProvisionerCancel(t *testing.T) {
 		t.Fatal("cancel should be called")
 	}
 }
+
+func TestRetriedProvisioner_impl(t *testing.T) {
+	var _ Provisioner = new(RetriedProvisioner)
+}
+
+func TestRetriedProvisionerProvision(t *testing.T) {
+	attempts := 0
+	mock := &MockProvisioner{
+		ProvFunc: func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("failed")
+			}
+
+			return nil
+		},
+	}
+
+	prov := &RetriedProvisioner{
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+		Provisioner:  mock,
+	}
+
+	if err := prov.Provision(testUi(), new(MockCommunicator)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("bad: %d", attempts)
+	}
+}
+
+func TestRetriedProvisionerProvision_fails(t *testing.T) {
+	attempts := 0
+	mock := &MockProvisioner{
+		ProvFunc: func() error {
+			attempts++
+			return errors.New("failed")
+		},
+	}
+
+	prov := &RetriedProvisioner{
+		MaxRetries:  2,
+		Provisioner: mock,
+	}
+
+	err := prov.Provision(testUi(), new(MockCommunicator))
+	if err == nil || !strings.Contains(err.Error(), "3 attempts") {
+		t.Fatalf("bad: %s", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("bad: %d", attempts)
+	}
+}
+
+func TestRetriedProvisionerCancel(t *testing.T) {
+	provCh := make(chan struct{}, 1)
+	mock := &MockProvisioner{
+		ProvFunc: func() error {
+			provCh <- struct{}{}
+			return errors.New("failed")
+		},
+	}
+
+	prov := &RetriedProvisioner{
+		MaxRetries:   5,
+		RetryBackoff: time.Minute,
+		Provisioner:  mock,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- prov.Provision(testUi(), new(MockCommunicator))
+	}()
+	<-provCh
+
+	// Cancelling during the backoff stops the retries
+	time.Sleep(10 * time.Millisecond)
+	prov.Cancel()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("should have error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("should stop retrying")
+	}
+
+	select {
+	case <-provCh:
+		t.Fatal("should not retry")
+	default:
+	}
+}
+
+func TestTimeoutProvisioner_impl(t *testing.T) {
+	var _ Provisioner = new(TimeoutProvisioner)
+}
+
+func TestTimeoutProvisionerProvision(t *testing.T) {
+	mock := new(MockProvisioner)
+	prov := &TimeoutProvisioner{
+		Timeout:     time.Minute,
+		Provisioner: mock,
+	}
+
+	if err := prov.Provision(testUi(), new(MockCommunicator)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !mock.ProvCalled {
+		t.Fatal("prov should be called")
+	}
+	if mock.CancelCalled {
+		t.Fatal("cancel should not be called")
+	}
+}
+
+// hangingCommunicator is a Communicator whose commands never exit
+// unless they are aborted.
+type hangingCommunicator struct {
+	MockCommunicator
+
+	aborted chan struct{}
+}
+
+func (c *hangingCommunicator) Start(cmd *RemoteCmd) error {
+	cmd.SetAbort(func() { close(c.aborted) })
+	return nil
+}
+
+func TestTimeoutProvisionerProvision_timeout(t *testing.T) {
+	comm := &hangingCommunicator{aborted: make(chan struct{})}
+	var exitStatus int
+	var mock *MockProvisioner
+	mock = &MockProvisioner{
+		ProvFunc: func() error {
+			cmd := &RemoteCmd{Command: "hang"}
+			if err := mock.ProvCommunicator.Start(cmd); err != nil {
+				return err
+			}
+
+			cmd.Wait()
+			exitStatus = cmd.ExitStatus
+			return errors.New("failed")
+		},
+	}
+
+	prov := &TimeoutProvisioner{
+		Timeout:     10 * time.Millisecond,
+		Provisioner: mock,
+	}
+
+	err := prov.Provision(testUi(), comm)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	if !mock.CancelCalled {
+		t.Fatal("cancel should be called")
+	}
+
+	select {
+	case <-comm.aborted:
+	default:
+		t.Fatal("command should be aborted")
+	}
+
+	if exitStatus != CmdDisconnect {
+		t.Fatalf("bad: %d", exitStatus)
+	}
+}
+
+func TestTimeoutProvisionerProvision_stuck(t *testing.T) {
+	old := provisionAbortWait
+	provisionAbortWait = 10 * time.Millisecond
+	defer func() { provisionAbortWait = old }()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	mock := &MockProvisioner{
+		ProvFunc: func() error {
+			<-stopCh
+			return nil
+		},
+	}
+
+	prov := &TimeoutProvisioner{
+		Timeout:     10 * time.Millisecond,
+		Provisioner: mock,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- prov.Provision(testUi(), new(MockCommunicator))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("bad: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stuck provisioner should be abandoned")
+	}
+}
+
+func TestRetriedProvisionerProvision_newProvisioner(t *testing.T) {
+	first := &MockProvisioner{
+		ProvFunc: func() error {
+			return errors.New("failed")
+		},
+	}
+
+	var created []*MockProvisioner
+	prov := &RetriedProvisioner{
+		MaxRetries:  2,
+		Provisioner: first,
+		NewProvisioner: func() (Provisioner, error) {
+			p := new(MockProvisioner)
+			created = append(created, p)
+			return p, nil
+		},
+	}
+
+	if err := prov.Prepare(42); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := prov.Provision(testUi(), new(MockCommunicator)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !first.ProvCalled || len(created) != 1 {
+		t.Fatalf("bad: %#v", created)
+	}
+
+	retry := created[0]
+	if !retry.ProvCalled || !reflect.DeepEqual(retry.PrepConfigs, []interface{}{42}) {
+		t.Fatalf("bad: %#v", retry)
+	}
+}
+
+// abortingCommunicator is a Communicator that aborts while it transfers.
+type abortingCommunicator struct {
+	MockCommunicator
+
+	abort func()
+}
+
+func (c *abortingCommunicator) Upload(path string, r io.Reader) error {
+	c.abort()
+	_, err := ioutil.ReadAll(r)
+	return err
+}
+
+func (c *abortingCommunicator) Download(path string, w io.Writer) error {
+	c.abort()
+	_, err := w.Write([]byte("foo"))
+	return err
+}
+
+func TestAbortableCommunicator_transfers(t *testing.T) {
+	inner := new(abortingCommunicator)
+	comm := newAbortableCommunicator(inner)
+	inner.abort = comm.abort
+
+	// The transfers in progress fail instead of going on
+	if err := comm.Upload("foo", strings.NewReader("foo")); err != errProvisionAborted {
+		t.Fatalf("bad: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := comm.Download("foo", &buf); err != errProvisionAborted {
+		t.Fatalf("bad: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
@@ -19,6 +19,11 @@ type BuildServer struct {
 	mux   *MuxConn
 }
 
+type BuildSetDependencyArtifactArgs struct {
+	Name     string
+	Artifact packer.BuildArtifact
+}
+
 type BuildPrepareResponse struct {
 	Warnings []string
 	Error    *BasicError
@@ -79,6 +84,24 @@ func (b *build) SetForce(val bool) {
 	}
 }
 
+func (b *build) SetOnError(val string) {
+	if err := b.client.Call("Build.SetOnError", val, new(interface{})); err != nil {
+		panic(err)
+	}
+}
+
+func (b *build) DependsOn() (result []string) {
+	b.client.Call("Build.DependsOn", new(interface{}), &result)
+	return
+}
+
+func (b *build) SetDependencyArtifact(name string, artifact packer.BuildArtifact) {
+	args := &BuildSetDependencyArtifactArgs{name, artifact}
+	if err := b.client.Call("Build.SetDependencyArtifact", args, new(interface{})); err != nil {
+		panic(err)
+	}
+}
+
 func (b *build) Cancel() {
 	if err := b.client.Call("Build.Cancel", new(interface{}), new(interface{})); err != nil {
 		panic(err)
@@ -134,6 +157,21 @@ func (b *BuildServer) SetForce(val *bool, reply *interface{}) error {
 	return nil
 }
 
+func (b *BuildServer) SetOnError(val *string, reply *interface{}) error {
+	b.build.SetOnError(*val)
+	return nil
+}
+
+func (b *BuildServer) DependsOn(args *interface{}, reply *[]string) error {
+	*reply = b.build.DependsOn()
+	return nil
+}
+
+func (b *BuildServer) SetDependencyArtifact(args *BuildSetDependencyArtifactArgs, reply *interface{}) error {
+	b.build.SetDependencyArtifact(args.Name, args.Artifact)
+	return nil
+}
+
 func (b *BuildServer) Cancel(args *interface{}, reply *interface{}) error {
 	b.build.Cancel()
 	return nil
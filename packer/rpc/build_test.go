@@ -18,8 +18,12 @@ type testBuild struct {
 	runUi           packer.Ui
 	setDebugCalled  bool
 	setForceCalled  bool
+	onError         string
 	cancelCalled    bool
 
+	dependencyName     string
+	dependencyArtifact packer.BuildArtifact
+
 	errRunResult bool
 }
 
@@ -53,6 +57,19 @@ func (b *testBuild) SetForce(bool) {
 	b.setForceCalled = true
 }
 
+func (b *testBuild) SetOnError(val string) {
+	b.onError = val
+}
+
+func (b *testBuild) DependsOn() []string {
+	return []string{"base"}
+}
+
+func (b *testBuild) SetDependencyArtifact(name string, artifact packer.BuildArtifact) {
+	b.dependencyName = name
+	b.dependencyArtifact = artifact
+}
+
 func (b *testBuild) Cancel() {
 	b.cancelCalled = true
 }
@@ -116,6 +133,24 @@ func TestBuild(t *testing.T) {
 		t.Fatal("should be called")
 	}
 
+	// Test SetOnError
+	bClient.SetOnError(packer.OnErrorAsk)
+	if b.onError != packer.OnErrorAsk {
+		t.Fatalf("bad: %s", b.onError)
+	}
+
+	// Test DependsOn
+	if deps := bClient.DependsOn(); !reflect.DeepEqual(deps, []string{"base"}) {
+		t.Fatalf("bad: %#v", deps)
+	}
+
+	// Test SetDependencyArtifact
+	artifact := packer.BuildArtifact{Id: "foo", Files: []string{"a", "b"}}
+	bClient.SetDependencyArtifact("base", artifact)
+	if b.dependencyName != "base" || !reflect.DeepEqual(b.dependencyArtifact, artifact) {
+		t.Fatalf("bad: %s %#v", b.dependencyName, b.dependencyArtifact)
+	}
+
 	// Test Cancel
 	bClient.Cancel()
 	if !b.cancelCalled {
@@ -26,8 +26,13 @@ type CommandFinished struct {
 	ExitStatus int
 }
 
+// CommandAbort is sent by the client on the response stream of a command
+// to abort it.
+type CommandAbort struct{}
+
 type CommunicatorStartArgs struct {
 	Command          string
+	ReportDisconnect bool
 	StdinStreamId    uint32
 	StdoutStreamId   uint32
 	StderrStreamId   uint32
@@ -50,6 +55,12 @@ type CommunicatorUploadDirArgs struct {
 	Exclude []string
 }
 
+type CommunicatorDownloadDirArgs struct {
+	Dst     string
+	Src     string
+	Exclude []string
+}
+
 func Communicator(client *rpc.Client) *communicator {
 	return &communicator{client: client}
 }
@@ -57,6 +68,7 @@ func Communicator(client *rpc.Client) *communicator {
 func (c *communicator) Start(cmd *packer.RemoteCmd) (err error) {
 	var args CommunicatorStartArgs
 	args.Command = cmd.Command
+	args.ReportDisconnect = cmd.ReportDisconnect
 
 	if cmd.Stdin != nil {
 		args.StdinStreamId = c.mux.NextId()
@@ -86,6 +98,12 @@ func (c *communicator) Start(cmd *packer.RemoteCmd) (err error) {
 		}
 		defer conn.Close()
 
+		cmd.SetAbort(func() {
+			if err := gob.NewEncoder(conn).Encode(&CommandAbort{}); err != nil {
+				log.Printf("[ERR] Error aborting command: %s", err)
+			}
+		})
+
 		var finished CommandFinished
 		decoder := gob.NewDecoder(conn)
 		if err := decoder.Decode(&finished); err != nil {
@@ -147,11 +165,28 @@ func (c *communicator) Download(path string, w io.Writer) (err error) {
 	return
 }
 
+func (c *communicator) DownloadDir(src string, dst string, exclude []string) error {
+	args := &CommunicatorDownloadDirArgs{
+		Dst:     dst,
+		Src:     src,
+		Exclude: exclude,
+	}
+
+	var reply error
+	err := c.client.Call("Communicator.DownloadDir", args, &reply)
+	if err == nil {
+		err = reply
+	}
+
+	return err
+}
+
 func (c *CommunicatorServer) Start(args *CommunicatorStartArgs, reply *interface{}) error {
 	// Build the RemoteCmd on this side so that it all pipes over
 	// to the remote side.
 	var cmd packer.RemoteCmd
 	cmd.Command = args.Command
+	cmd.ReportDisconnect = args.ReportDisconnect
 
 	// Create a channel to signal we're done so that we can close
 	// our stdin/stdout/stderr streams
@@ -213,6 +248,16 @@ func (c *CommunicatorServer) Start(args *CommunicatorStartArgs, reply *interface
 		return NewBasicError(err)
 	}
 
+	// Abort the command if the client asks to. The decoding fails once
+	// the response stream is closed.
+	go func() {
+		var abort CommandAbort
+		if err := gob.NewDecoder(responseC).Decode(&abort); err == nil {
+			log.Printf("[INFO] RPC endpoint: Aborting command: %s", cmd.Command)
+			cmd.Abort()
+		}
+	}()
+
 	// Start a goroutine to spin and wait for the process to actual
 	// exit. When it does, report it back to caller...
 	go func() {
@@ -252,6 +297,10 @@ func (c *CommunicatorServer) Download(args *CommunicatorDownloadArgs, reply *int
 	return
 }
 
+func (c *CommunicatorServer) DownloadDir(args *CommunicatorDownloadDirArgs, reply *error) error {
+	return c.c.DownloadDir(args.Src, args.Dst, args.Exclude)
+}
+
 func serveSingleCopy(name string, mux *MuxConn, id uint32, dst io.Writer, src io.Reader) {
 	conn, err := mux.Accept(id)
 	if err != nil {
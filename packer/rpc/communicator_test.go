@@ -6,6 +6,7 @@ import (
 	"io"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCommunicatorRPC(t *testing.T) {
@@ -154,6 +155,24 @@ func TestCommunicatorRPC(t *testing.T) {
 	if downloadData != "download\n" {
 		t.Fatalf("bad: %s", downloadData)
 	}
+
+	// Test that we can download directories
+	err = remote.DownloadDir(dirSrc, dirDst, dirExcl)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.DownloadDirDst != dirDst {
+		t.Fatalf("bad: %s", c.DownloadDirDst)
+	}
+
+	if c.DownloadDirSrc != dirSrc {
+		t.Fatalf("bad: %s", c.DownloadDirSrc)
+	}
+
+	if !reflect.DeepEqual(c.DownloadDirExclude, dirExcl) {
+		t.Fatalf("bad: %#v", c.DownloadDirExclude)
+	}
 }
 
 func TestCommunicator_ImplementsCommunicator(t *testing.T) {
@@ -163,3 +182,42 @@ func TestCommunicator_ImplementsCommunicator(t *testing.T) {
 		t.Fatal("should be a Communicator")
 	}
 }
+
+// abortCommunicator is a Communicator whose commands run until they are
+// aborted.
+type abortCommunicator struct {
+	packer.MockCommunicator
+}
+
+func (c *abortCommunicator) Start(cmd *packer.RemoteCmd) error {
+	cmd.SetAbort(func() { cmd.SetExited(packer.CmdDisconnect) })
+	return nil
+}
+
+func TestCommunicatorRPC_abort(t *testing.T) {
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterCommunicator(new(abortCommunicator))
+	remote := client.Communicator()
+
+	cmd := &packer.RemoteCmd{Command: "foo"}
+	if err := remote.Start(cmd); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The abort function is set once the response stream is accepted
+	timeout := time.After(5 * time.Second)
+	for !cmd.Abort() {
+		select {
+		case <-timeout:
+			t.Fatal("command should be abortable")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cmd.Wait()
+	if cmd.ExitStatus != packer.CmdDisconnect {
+		t.Fatalf("bad exit: %d", cmd.ExitStatus)
+	}
+}
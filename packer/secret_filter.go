@@ -0,0 +1,101 @@
+package packer
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SensitiveMask is what sensitive values are replaced with in output.
+const SensitiveMask = "<sensitive>"
+
+// LogSecretFilter is the filter for the values of sensitive variables.
+// Every Ui filters its output through it, and Packer sends its log output
+// through it as well.
+var LogSecretFilter = new(SecretFilter)
+
+// SecretFilter replaces secret values with SensitiveMask. It is an
+// io.Writer that filters what is written to it before writing it on to
+// its output. It is safe to use from multiple goroutines.
+type SecretFilter struct {
+	output  io.Writer
+	secrets []string
+	l       sync.RWMutex
+}
+
+// Set adds secrets to the values that are filtered. Empty values are
+// ignored.
+func (f *SecretFilter) Set(secrets ...string) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	for _, secret := range secrets {
+		if secret == "" || f.has(secret) {
+			continue
+		}
+
+		f.secrets = append(f.secrets, secret)
+	}
+
+	// Replace the longest secrets first so that a secret containing
+	// another one is masked completely.
+	sort.Sort(byLength(f.secrets))
+}
+
+// SetOutput sets the writer that filtered output is written to.
+func (f *SecretFilter) SetOutput(w io.Writer) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.output = w
+}
+
+// FilterString returns the string with all the secrets replaced.
+func (f *SecretFilter) FilterString(message string) string {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	for _, secret := range f.secrets {
+		message = strings.Replace(message, secret, SensitiveMask, -1)
+	}
+
+	return message
+}
+
+// Write filters p and writes the result to the output. The length of
+// p is returned on success, since the caller doesn't care that the
+// filtered data may be a different length.
+func (f *SecretFilter) Write(p []byte) (int, error) {
+	filtered := f.FilterString(string(p))
+
+	f.l.RLock()
+	output := f.output
+	f.l.RUnlock()
+
+	if output == nil {
+		return len(p), nil
+	}
+
+	if _, err := io.WriteString(output, filtered); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (f *SecretFilter) has(secret string) bool {
+	for _, s := range f.secrets {
+		if s == secret {
+			return true
+		}
+	}
+
+	return false
+}
+
+type byLength []string
+
+func (s byLength) Len() int           { return len(s) }
+func (s byLength) Less(i, j int) bool { return len(s[i]) > len(s[j]) }
+func (s byLength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,43 @@
+package packer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSecretFilter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	f := new(SecretFilter)
+	f.SetOutput(buf)
+	f.Set("foo", "", "foobar", "foo")
+
+	if len(f.secrets) != 2 {
+		t.Fatalf("bad: %#v", f.secrets)
+	}
+
+	actual := f.FilterString("a foobar b foo c")
+	expected := "a <sensitive> b <sensitive> c"
+	if actual != expected {
+		t.Fatalf("bad: %s", actual)
+	}
+
+	n, err := f.Write([]byte("foo!\n"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if n != 5 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	if buf.String() != "<sensitive>!\n" {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestSecretFilter_noOutput(t *testing.T) {
+	f := new(SecretFilter)
+	if _, err := f.Write([]byte("foo")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -27,6 +27,8 @@ type rawTemplate struct {
 	PostProcessors []interface{} `mapstructure:"post-processors"`
 	Provisioners   []map[string]interface{}
 	Variables      map[string]interface{}
+
+	SensitiveVariables []string `mapstructure:"sensitive-variables"`
 }
 
 // The Template struct represents a parsed template, parsed into the most
@@ -38,6 +40,10 @@ type Template struct {
 	Hooks          map[string][]string
 	PostProcessors [][]RawPostProcessorConfig
 	Provisioners   []RawProvisionerConfig
+
+	// Path is the path to the file the template was read from, or empty
+	// if it wasn't read from a file.
+	Path string
 }
 
 // The RawBuilderConfig struct represents a raw, unprocessed builder
@@ -48,6 +54,10 @@ type RawBuilderConfig struct {
 	Name string
 	Type string
 
+	// DependsOn are the names of the builders whose builds must finish
+	// before this one starts, since it uses their artifacts.
+	DependsOn []string `mapstructure:"depends_on"`
+
 	RawConfig interface{}
 }
 
@@ -56,6 +66,7 @@ type RawBuilderConfig struct {
 // raw configuration that is handed to the post-processor for it to process.
 type RawPostProcessorConfig struct {
 	TemplateOnlyExcept `mapstructure:",squash"`
+	TemplateCondition  `mapstructure:",squash"`
 
 	Type              string
 	KeepInputArtifact bool `mapstructure:"keep_input_artifact"`
@@ -67,22 +78,33 @@ type RawPostProcessorConfig struct {
 // that is handed to the provisioner for it to process.
 type RawProvisionerConfig struct {
 	TemplateOnlyExcept `mapstructure:",squash"`
+	TemplateCondition  `mapstructure:",squash"`
 
-	Type           string
-	Override       map[string]interface{}
-	RawPauseBefore string `mapstructure:"pause_before"`
+	Type            string
+	Override        map[string]interface{}
+	RawPauseBefore  string `mapstructure:"pause_before"`
+	MaxRetries      int    `mapstructure:"max_retries"`
+	RawRetryBackoff string `mapstructure:"retry_backoff"`
+	RawTimeout      string `mapstructure:"timeout"`
 
 	RawConfig interface{}
 
-	pauseBefore time.Duration
+	pauseBefore  time.Duration
+	retryBackoff time.Duration
+	timeout      time.Duration
 }
 
 // RawVariable represents a variable configuration within a template.
 type RawVariable struct {
+	Type     string // The type of the variable, such as VariableTypeList
 	Default  string // The default value for this variable
 	Required bool   // If the variable is required or not
 	Value    string // The set value for this variable
 	HasValue bool   // True if the value was set
+
+	// Sensitive is true if the value of the variable must be masked in
+	// all output.
+	Sensitive bool
 }
 
 // ParseTemplate takes a byte slice and parses a Template from it, returning
@@ -92,13 +114,31 @@ type RawVariable struct {
 // way.
 //
 // The second parameter, vars, are the values for a set of user variables.
-func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error) {
+//
+// Templates included by the template are read relative to the current
+// working directory. Use ParseTemplateFile to read them relative to the
+// template itself.
+func ParseTemplate(data []byte, vars map[string]string) (*Template, error) {
+	return parseTemplate(data, vars, "")
+}
+
+// parseTemplate parses the template, which was read from the file at the
+// given path, or from elsewhere if the path is empty.
+func parseTemplate(data []byte, vars map[string]string, path string) (t *Template, err error) {
 	var rawTplInterface interface{}
 	err = jsonutil.Unmarshal(data, &rawTplInterface)
 	if err != nil {
 		return
 	}
 
+	// Merge in any included templates before anything else, so that the
+	// rest of the parsing sees a single template.
+	if rawMap, ok := rawTplInterface.(map[string]interface{}); ok {
+		if err = resolveIncludes(rawMap, path); err != nil {
+			return
+		}
+	}
+
 	// Decode the raw template interface into the actual rawTemplate
 	// structure, checking for any extranneous keys along the way.
 	var md mapstructure.Metadata
@@ -148,6 +188,7 @@ func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error)
 	}
 
 	t = &Template{}
+	t.Path = path
 	t.Description = rawTpl.Description
 	t.Variables = make(map[string]RawVariable)
 	t.Builders = make(map[string]RawBuilderConfig)
@@ -157,38 +198,48 @@ func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error)
 
 	// Gather all the variables
 	for k, v := range rawTpl.Variables {
-		var variable RawVariable
-		variable.Required = v == nil
-
-		// Create a new mapstructure decoder in order to decode the default
-		// value since this is the only value in the regular template that
-		// can be weakly typed.
-		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			Result:           &variable.Default,
-			WeaklyTypedInput: true,
-		})
-		if err != nil {
-			// This should never happen.
-			panic(err)
-		}
-
-		err = decoder.Decode(v)
+		variable, err := parseRawVariable(v)
 		if err != nil {
 			errors = append(errors,
 				fmt.Errorf("Error decoding default value for user var '%s': %s", k, err))
 			continue
 		}
 
-		// Set the value of this variable if we have it
+		// Set the value of this variable if we have it, making sure
+		// that it is of the right type.
 		if val, ok := vars[k]; ok {
+			delete(vars, k)
+
+			val, err = convertVariable(variable.Type, val)
+			if err != nil {
+				errors = append(errors,
+					fmt.Errorf("Invalid value for user var '%s': %s", k, err))
+				continue
+			}
+
 			variable.HasValue = true
 			variable.Value = val
-			delete(vars, k)
 		}
 
 		t.Variables[k] = variable
 	}
 
+	// Mark the sensitive variables, which must all be defined.
+	for _, k := range rawTpl.SensitiveVariables {
+		variable, ok := t.Variables[k]
+		if !ok {
+			if _, ok := rawTpl.Variables[k]; !ok {
+				errors = append(errors,
+					fmt.Errorf("Sensitive variable '%s' is not defined", k))
+			}
+
+			continue
+		}
+
+		variable.Sensitive = true
+		t.Variables[k] = variable
+	}
+
 	// Gather all the builders
 	for i, v := range rawTpl.Builders {
 		var raw RawBuilderConfig
@@ -224,13 +275,17 @@ func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error)
 
 		// Now that we have the name, remove it from the config - as the builder
 		// itself doesn't know about, and it will cause a validation error.
+		// The same goes for the dependencies.
 		delete(v, "name")
+		delete(v, "depends_on")
 
 		raw.RawConfig = v
 
 		t.Builders[raw.Name] = raw
 	}
 
+	errors = append(errors, checkBuildDependencies(t.Builders)...)
+
 	// Gather all the post-processors. This is a complicated process since there
 	// are actually three different formats that the user can use to define
 	// a post-processor.
@@ -266,10 +321,13 @@ func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error)
 
 			// Remove the input keep_input_artifact option
 			config.TemplateOnlyExcept.Prune(pp)
+			config.TemplateCondition.Prune(pp)
 			delete(pp, "keep_input_artifact")
 
-			// Verify that the only settings are good
-			if errs := config.TemplateOnlyExcept.Validate(t.Builders); len(errs) > 0 {
+			// Verify that the only settings and the condition are good
+			errs := config.TemplateOnlyExcept.Validate(t.Builders)
+			errs = append(errs, config.TemplateCondition.Validate()...)
+			if len(errs) > 0 {
 				for _, err := range errs {
 					errors = append(errors,
 						fmt.Errorf("Post-processor %d.%d: %s", i+1, j+1, err))
@@ -309,6 +367,7 @@ func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error)
 
 		// Delete the keys that we used
 		raw.TemplateOnlyExcept.Prune(v)
+		raw.TemplateCondition.Prune(v)
 		delete(v, "override")
 
 		// Verify that the override keys exist...
@@ -319,12 +378,12 @@ func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error)
 			}
 		}
 
-		// Verify that the only settings are good
-		if errs := raw.TemplateOnlyExcept.Validate(t.Builders); len(errs) > 0 {
-			for _, err := range errs {
-				errors = append(errors,
-					fmt.Errorf("provisioner %d: %s", i+1, err))
-			}
+		// Verify that the only settings and the condition are good
+		errs := raw.TemplateOnlyExcept.Validate(t.Builders)
+		errs = append(errs, raw.TemplateCondition.Validate()...)
+		for _, err := range errs {
+			errors = append(errors,
+				fmt.Errorf("provisioner %d: %s", i+1, err))
 		}
 
 		// Setup the pause settings
@@ -340,9 +399,43 @@ func ParseTemplate(data []byte, vars map[string]string) (t *Template, err error)
 			raw.pauseBefore = duration
 		}
 
-		// Remove the pause_before setting if it is there so that we don't
-		// get template validation errors later.
+		// Setup the retry and timeout settings
+		if raw.MaxRetries < 0 {
+			errors = append(
+				errors, fmt.Errorf(
+					"provisioner %d: max_retries can't be negative", i+1))
+		}
+
+		if raw.RawRetryBackoff != "" {
+			duration, err := time.ParseDuration(raw.RawRetryBackoff)
+			if err != nil {
+				errors = append(
+					errors, fmt.Errorf(
+						"provisioner %d: retry_backoff invalid: %s",
+						i+1, err))
+			}
+
+			raw.retryBackoff = duration
+		}
+
+		if raw.RawTimeout != "" {
+			duration, err := time.ParseDuration(raw.RawTimeout)
+			if err != nil {
+				errors = append(
+					errors, fmt.Errorf(
+						"provisioner %d: timeout invalid: %s",
+						i+1, err))
+			}
+
+			raw.timeout = duration
+		}
+
+		// Remove the settings that are handled here so that we don't get
+		// template validation errors later.
 		delete(v, "pause_before")
+		delete(v, "max_retries")
+		delete(v, "retry_backoff")
+		delete(v, "timeout")
 
 		raw.RawConfig = v
 	}
@@ -372,6 +465,9 @@ func ParseTemplateFile(path string, vars map[string]string) (*Template, error) {
 	var data []byte
 
 	if path == "-" {
+		// Includes are relative to the working directory
+		path = ""
+
 		// Read from stdin...
 		buf := new(bytes.Buffer)
 		_, err := io.Copy(buf, os.Stdin)
@@ -388,7 +484,7 @@ func ParseTemplateFile(path string, vars map[string]string) (*Template, error) {
 		}
 	}
 
-	return ParseTemplate(data, vars)
+	return parseTemplate(data, vars, path)
 }
 
 func parsePostProcessor(i int, rawV interface{}) (result []map[string]interface{}, errors []error) {
@@ -480,6 +576,7 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 	if err != nil {
 		return nil, err
 	}
+	varTpl.TemplatePath = t.Path
 	varTpl.Funcs(template.FuncMap{
 		"env":  templateEnv,
 		"user": templateDisableUser,
@@ -498,7 +595,7 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 		if v.HasValue {
 			val = v.Value
 		} else {
-			val, err = varTpl.Process(v.Default, nil)
+			val, err = processVariable(varTpl, v.Type, v.Default)
 			if err != nil {
 				varErrors = append(varErrors,
 					fmt.Errorf("Error processing user variable '%s': %s'", k, err))
@@ -506,6 +603,12 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 		}
 
 		variables[k] = val
+
+		// Now that the real value is known, make sure that it never
+		// makes it to the output.
+		if v.Sensitive {
+			LogSecretFilter.Set(sensitiveValues(v.Type, val)...)
+		}
 	}
 
 	if len(varErrors) > 0 {
@@ -518,12 +621,28 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 		return nil, err
 	}
 	tpl.UserVars = variables
+	tpl.TemplatePath = t.Path
 
 	name, err = tpl.Process(name, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	// The names of the builds this one depends on are processed the
+	// same way, so that they match the names of those builds.
+	dependsOn := make([]string, len(builderConfig.DependsOn))
+	for i, dep := range builderConfig.DependsOn {
+		dependsOn[i], err = tpl.Process(dep, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The conditions of provisioners and post-processors can use the
+	// build functions as well.
+	tpl.BuildName = name
+	tpl.BuildType = builderConfig.Type
+
 	// Gather the Hooks
 	hooks := make(map[string][]Hook)
 	for tplEvent, tplHooks := range t.Hooks {
@@ -556,6 +675,14 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 				continue
 			}
 
+			skip, err := rawPP.TemplateCondition.Skip(tpl)
+			if err != nil {
+				return nil, fmt.Errorf("Post-processor '%s': %s", rawPP.Type, err)
+			}
+			if skip {
+				continue
+			}
+
 			pp, err := components.PostProcessor(rawPP.Type)
 			if err != nil {
 				return nil, err
@@ -589,14 +716,40 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 			continue
 		}
 
-		var provisioner Provisioner
-		provisioner, err = components.Provisioner(rawProvisioner.Type)
+		var skip bool
+		skip, err = rawProvisioner.TemplateCondition.Skip(tpl)
 		if err != nil {
-			return
+			return nil, fmt.Errorf("Provisioner '%s': %s", rawProvisioner.Type, err)
+		}
+		if skip {
+			continue
+		}
+
+		// Retries get a new provisioner, so this is used to create each one.
+		provType, timeout := rawProvisioner.Type, rawProvisioner.timeout
+		newProvisioner := func() (Provisioner, error) {
+			provisioner, err := components.Provisioner(provType)
+			if err != nil {
+				return nil, err
+			}
+
+			if provisioner == nil {
+				return nil, fmt.Errorf("Provisioner type not found: %s", provType)
+			}
+
+			if timeout > 0 {
+				provisioner = &TimeoutProvisioner{
+					Timeout:     timeout,
+					Provisioner: provisioner,
+				}
+			}
+
+			return provisioner, nil
 		}
 
-		if provisioner == nil {
-			err = fmt.Errorf("Provisioner type not found: %s", rawProvisioner.Type)
+		var provisioner Provisioner
+		provisioner, err = newProvisioner()
+		if err != nil {
 			return
 		}
 
@@ -609,6 +762,15 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 			}
 		}
 
+		if rawProvisioner.MaxRetries > 0 {
+			provisioner = &RetriedProvisioner{
+				MaxRetries:     rawProvisioner.MaxRetries,
+				RetryBackoff:   rawProvisioner.retryBackoff,
+				Provisioner:    provisioner,
+				NewProvisioner: newProvisioner,
+			}
+		}
+
 		if rawProvisioner.pauseBefore > 0 {
 			provisioner = &PausedProvisioner{
 				PauseBefore: rawProvisioner.pauseBefore,
@@ -625,9 +787,11 @@ func (t *Template) Build(name string, components *ComponentFinder) (b Build, err
 		builder:        builder,
 		builderConfig:  builderConfig.RawConfig,
 		builderType:    builderConfig.Type,
+		dependsOn:      dependsOn,
 		hooks:          hooks,
 		postProcessors: postProcessors,
 		provisioners:   provisioners,
+		templatePath:   t.Path,
 		variables:      variables,
 	}
 
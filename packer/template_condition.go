@@ -0,0 +1,64 @@
+package packer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TemplateCondition contains the logic required for the "if"
+// meta-parameter. It is a configuration template that is processed with
+// the user variables and build functions such as "build_name", and the
+// item is only put onto the build if the result is true.
+type TemplateCondition struct {
+	If string `mapstructure:"if"`
+}
+
+// Prune will prune out the used values from the raw map.
+func (c *TemplateCondition) Prune(raw map[string]interface{}) {
+	delete(raw, "if")
+}
+
+// Validate checks the syntax of the condition.
+func (c *TemplateCondition) Validate() []error {
+	if c.If == "" {
+		return nil
+	}
+
+	tpl, err := NewConfigTemplate()
+	if err != nil {
+		return []error{err}
+	}
+
+	if err := tpl.Validate(c.If); err != nil {
+		return []error{fmt.Errorf("'if' is not a valid template: %s", err)}
+	}
+
+	return nil
+}
+
+// Skip processes the condition with the given template and tests if we
+// should skip putting this item onto the build. An empty result is false.
+func (c *TemplateCondition) Skip(tpl *ConfigTemplate) (bool, error) {
+	if c.If == "" {
+		return false, nil
+	}
+
+	result, err := tpl.Process(c.If, nil)
+	if err != nil {
+		return false, fmt.Errorf("Error processing 'if': %s", err)
+	}
+
+	result = strings.TrimSpace(result)
+	if result == "" {
+		return true, nil
+	}
+
+	value, err := strconv.ParseBool(result)
+	if err != nil {
+		return false, fmt.Errorf(
+			"'if' must result in true or false, got '%s'", result)
+	}
+
+	return !value, nil
+}
@@ -0,0 +1,249 @@
+package packer
+
+import (
+	"fmt"
+	jsonutil "github.com/mitchellh/packer/common/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// includeKeys are the root level keys of a template that can come from
+// included templates.
+var includeKeys = map[string]bool{
+	"builders":            true,
+	"post-processors":     true,
+	"provisioners":        true,
+	"sensitive-variables": true,
+	"variables":           true,
+}
+
+// templateMerger merges the contents of templates together, keeping
+// track of where each builder and variable came from so that conflicts
+// can be reported.
+type templateMerger struct {
+	builders  map[string]string
+	variables map[string]string
+	result    map[string]interface{}
+}
+
+// resolveIncludes replaces the "include" key of the raw template with the
+// contents of the templates it lists, which are merged into it. The name
+// is the path of the template, or empty if it didn't come from a file.
+// Include paths are relative to the directory of the template.
+func resolveIncludes(raw map[string]interface{}, name string) error {
+	stack := make([]string, 0, 1)
+	if name != "" {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return err
+		}
+
+		stack = append(stack, abs)
+	}
+
+	return resolveIncludesStack(raw, name, stack)
+}
+
+func resolveIncludesStack(raw map[string]interface{}, name string, stack []string) error {
+	rawIncludes, ok := raw["include"]
+	if !ok {
+		return nil
+	}
+	delete(raw, "include")
+
+	includes, err := includePaths(rawIncludes)
+	if err != nil {
+		return err
+	}
+
+	dir := "."
+	if name != "" {
+		dir = filepath.Dir(name)
+	}
+
+	m := &templateMerger{
+		builders:  make(map[string]string),
+		variables: make(map[string]string),
+		result:    make(map[string]interface{}),
+	}
+
+	for _, include := range includes {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range stack {
+			if s == abs {
+				return fmt.Errorf(
+					"Template include cycle: %s", strings.Join(append(stack, abs), " -> "))
+			}
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Error reading included template: %s", err)
+		}
+
+		var rawInclude interface{}
+		if err := jsonutil.Unmarshal(data, &rawInclude); err != nil {
+			return fmt.Errorf("Error parsing included template '%s': %s", path, err)
+		}
+
+		included, ok := rawInclude.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Included template '%s' must be a JSON object", path)
+		}
+
+		if err := resolveIncludesStack(included, path, append(stack, abs)); err != nil {
+			return err
+		}
+
+		for k := range included {
+			if !includeKeys[k] {
+				return fmt.Errorf(
+					"Included template '%s': root level key '%s' can't be included. "+
+						"Only builders, post-processors, provisioners, variables and "+
+						"sensitive-variables can.",
+					path, k)
+			}
+		}
+
+		if err := m.merge(included, path); err != nil {
+			return err
+		}
+	}
+
+	// The template itself comes last, so that its provisioners and
+	// post-processors run after the included ones.
+	source := name
+	if source == "" {
+		source = "the template"
+	}
+
+	own := make(map[string]interface{})
+	for k, v := range raw {
+		if includeKeys[k] {
+			own[k] = v
+			delete(raw, k)
+		}
+	}
+
+	if err := m.merge(own, source); err != nil {
+		return err
+	}
+
+	for k, v := range m.result {
+		raw[k] = v
+	}
+
+	return nil
+}
+
+// merge merges the included keys of the raw template into the result.
+func (m *templateMerger) merge(raw map[string]interface{}, source string) error {
+	for _, k := range []string{"builders", "post-processors", "provisioners", "sensitive-variables"} {
+		v, ok := raw[k]
+		if !ok {
+			continue
+		}
+
+		list, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("'%s' in %s must be a list", k, source)
+		}
+
+		if k == "builders" {
+			if err := m.addBuilders(list, source); err != nil {
+				return err
+			}
+		}
+
+		existing, _ := m.result[k].([]interface{})
+		m.result[k] = append(existing, list...)
+	}
+
+	if v, ok := raw["variables"]; ok {
+		vars, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("'variables' in %s must be an object", source)
+		}
+
+		result, _ := m.result["variables"].(map[string]interface{})
+		if result == nil {
+			result = make(map[string]interface{})
+			m.result["variables"] = result
+		}
+
+		for name, def := range vars {
+			if existing, ok := result[name]; ok && !reflect.DeepEqual(existing, def) {
+				return fmt.Errorf(
+					"Variable '%s' is defined differently in %s and %s",
+					name, m.variables[name], source)
+			}
+
+			if _, ok := m.variables[name]; !ok {
+				m.variables[name] = source
+			}
+			result[name] = def
+		}
+	}
+
+	return nil
+}
+
+// addBuilders records the names of the builders, failing if a builder
+// with the same name came from somewhere else.
+func (m *templateMerger) addBuilders(builders []interface{}, source string) error {
+	for _, raw := range builders {
+		b, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := b["name"].(string)
+		if name == "" {
+			name, _ = b["type"].(string)
+		}
+
+		if name == "" {
+			continue
+		}
+
+		if existing, ok := m.builders[name]; ok {
+			return fmt.Errorf(
+				"Builder with name '%s' is defined in both %s and %s",
+				name, existing, source)
+		}
+
+		m.builders[name] = source
+	}
+
+	return nil
+}
+
+func includePaths(raw interface{}) ([]string, error) {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'include' must be a list of paths to templates")
+	}
+
+	result := make([]string, len(list))
+	for i, v := range list {
+		path, ok := v.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("'include' must be a list of paths to templates")
+		}
+
+		result[i] = path
+	}
+
+	return result, nil
+}
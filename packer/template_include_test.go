@@ -0,0 +1,178 @@
+package packer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplates writes the templates into a new temporary directory,
+// returning the directory.
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	return dir
+}
+
+func TestParseTemplateFile_include(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"template.json": `{
+			"include": ["shared/base.json"],
+			"builders": [{"type": "foo"}],
+			"provisioners": [{"type": "own"}]
+		}`,
+		"shared/base.json": `{
+			"include": ["provisioners.json"],
+			"variables": {"foo": "bar"},
+			"builders": [{"type": "bar"}],
+			"post-processors": ["compress"]
+		}`,
+		"shared/provisioners.json": `{
+			"provisioners": [{"type": "shell"}, {"type": "file"}]
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	result, err := ParseTemplateFile(filepath.Join(dir, "template.json"), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(result.Builders) != 2 {
+		t.Fatalf("bad: %#v", result.Builders)
+	}
+
+	if _, ok := result.Builders["bar"]; !ok {
+		t.Fatalf("bad: %#v", result.Builders)
+	}
+
+	if result.Variables["foo"].Default != "bar" {
+		t.Fatalf("bad: %#v", result.Variables)
+	}
+
+	if len(result.PostProcessors) != 1 {
+		t.Fatalf("bad: %#v", result.PostProcessors)
+	}
+
+	types := make([]string, len(result.Provisioners))
+	for i, p := range result.Provisioners {
+		types[i] = p.Type
+	}
+
+	if strings.Join(types, ",") != "shell,file,own" {
+		t.Fatalf("bad: %#v", types)
+	}
+}
+
+func TestParseTemplateFile_includeBuilderConflict(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"template.json": `{
+			"include": ["a.json"],
+			"builders": [{"type": "foo"}]
+		}`,
+		"a.json": `{
+			"builders": [{"type": "bar", "name": "foo"}]
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := ParseTemplateFile(filepath.Join(dir, "template.json"), nil)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	if !strings.Contains(err.Error(), "'foo'") || !strings.Contains(err.Error(), "a.json") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestParseTemplateFile_includeVariableConflict(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"template.json": `{
+			"include": ["a.json", "b.json"],
+			"builders": [{"type": "foo"}]
+		}`,
+		"a.json": `{"variables": {"foo": "bar", "same": "yes"}}`,
+		"b.json": `{"variables": {"foo": "baz", "same": "yes"}}`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := ParseTemplateFile(filepath.Join(dir, "template.json"), nil)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	if !strings.Contains(err.Error(), "'foo'") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// Identical definitions are fine
+	dir2 := writeTemplates(t, map[string]string{
+		"template.json": `{
+			"include": ["a.json", "b.json"],
+			"builders": [{"type": "foo"}]
+		}`,
+		"a.json": `{"variables": {"same": "yes"}}`,
+		"b.json": `{"variables": {"same": "yes"}}`,
+	})
+	defer os.RemoveAll(dir2)
+
+	if _, err := ParseTemplateFile(filepath.Join(dir2, "template.json"), nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestParseTemplateFile_includeCycle(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"template.json": `{
+			"include": ["a.json"],
+			"builders": [{"type": "foo"}]
+		}`,
+		"a.json": `{"include": ["template.json"]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := ParseTemplateFile(filepath.Join(dir, "template.json"), nil)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestParseTemplateFile_includeBadKey(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"template.json": `{
+			"include": ["a.json"],
+			"builders": [{"type": "foo"}]
+		}`,
+		"a.json": `{"description": "nope"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := ParseTemplateFile(filepath.Join(dir, "template.json"), nil)
+	if err == nil || !strings.Contains(err.Error(), "description") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestParseTemplate_includeInvalid(t *testing.T) {
+	_, err := ParseTemplate([]byte(`{"include": "foo.json"}`), nil)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -58,6 +59,10 @@ func TestParseTemplateFile_basic(t *testing.T) {
 	if len(result.Builders) != 1 {
 		t.Fatalf("bad: %#v", result.Builders)
 	}
+
+	if result.Path != tf.Name() {
+		t.Fatalf("bad: %s", result.Path)
+	}
 }
 
 func TestParseTemplateFile_minPackerVersionBad(t *testing.T) {
@@ -358,6 +363,58 @@ func TestParseTemplate_BuilderWithConflictingName(t *testing.T) {
 	}
 }
 
+func TestParseTemplate_BuilderDependsOn(t *testing.T) {
+	data := `
+	{
+		"builders": [
+			{"type": "vmware-iso", "name": "base"},
+			{"type": "vmware-vmx", "depends_on": ["base"]}
+		]
+	}
+	`
+
+	result, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	builder := result.Builders["vmware-vmx"]
+	if !reflect.DeepEqual(builder.DependsOn, []string{"base"}) {
+		t.Fatalf("bad: %#v", builder.DependsOn)
+	}
+
+	if _, ok := builder.RawConfig.(map[string]interface{})["depends_on"]; ok {
+		t.Fatal("depends_on should not be in the builder config")
+	}
+
+	if len(result.Builders["base"].DependsOn) != 0 {
+		t.Fatalf("bad: %#v", result.Builders["base"].DependsOn)
+	}
+}
+
+func TestParseTemplate_BuilderDependsOnBad(t *testing.T) {
+	cases := map[string]string{
+		"unknown": `{"builders": [{"type": "foo", "depends_on": ["bar"]}]}`,
+		"itself":  `{"builders": [{"type": "foo", "depends_on": ["foo"]}]}`,
+		"cycle": `{"builders": [
+			{"type": "a", "depends_on": ["c"]},
+			{"type": "b", "depends_on": ["a"]},
+			{"type": "c", "depends_on": ["b"]}
+		]}`,
+	}
+
+	for expected, data := range cases {
+		_, err := ParseTemplate([]byte(data), nil)
+		if err == nil {
+			t.Fatalf("should have error: %s", expected)
+		}
+
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("bad: %s", err)
+		}
+	}
+}
+
 func TestParseTemplate_Hooks(t *testing.T) {
 	data := `
 	{
@@ -597,6 +654,48 @@ func TestParseTemplate_Variables(t *testing.T) {
 	}
 }
 
+func TestParseTemplate_sensitiveVariables(t *testing.T) {
+	data := `
+	{
+		"variables": {
+			"foo": "bar",
+			"secret": null
+		},
+
+		"sensitive-variables": ["secret"],
+
+		"builders": [{"type": "something"}]
+	}
+	`
+
+	result, err := ParseTemplate([]byte(data), map[string]string{
+		"secret": "hunter2",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Variables["foo"].Sensitive {
+		t.Fatal("foo should not be sensitive")
+	}
+
+	if !result.Variables["secret"].Sensitive {
+		t.Fatal("secret should be sensitive")
+	}
+
+	// Undefined
+	data = `
+	{
+		"sensitive-variables": ["secret"],
+		"builders": [{"type": "something"}]
+	}
+	`
+
+	if _, err := ParseTemplate([]byte(data), nil); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
 func TestParseTemplate_variablesSet(t *testing.T) {
 	data := `
 	{
@@ -669,6 +768,52 @@ func TestParseTemplate_variablesBadDefault(t *testing.T) {
 	}
 }
 
+func TestParseTemplate_variablesTyped(t *testing.T) {
+	data := `
+	{
+		"variables": {
+			"mirrors": ["a", "b"],
+			"tags": {"type": "map", "default": {"foo": "bar"}},
+			"count": {"type": "number", "default": 2}
+		},
+
+		"builders": [{"type": "something"}]
+	}
+	`
+
+	result, err := ParseTemplate([]byte(data), map[string]string{
+		"mirrors": "c,d",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if v := result.Variables["mirrors"]; v.Type != VariableTypeList || v.Value != `["c","d"]` {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	if v := result.Variables["tags"]; v.Type != VariableTypeMap || v.Default != `{"foo":"bar"}` {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	if v := result.Variables["count"]; v.Type != VariableTypeNumber || v.Default != "2" {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	// Values must match the type of the variable
+	_, err = ParseTemplate([]byte(data), map[string]string{
+		"count": "many",
+		"tags":  "foo",
+	})
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	if merr, ok := err.(*MultiError); !ok || len(merr.Errors) != 2 {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
 func TestTemplate_BuildNames(t *testing.T) {
 	data := `
 	{
@@ -1417,6 +1562,172 @@ func TestTemplateBuild_onlyProv(t *testing.T) {
 	}
 }
 
+func TestTemplateBuild_ifProv(t *testing.T) {
+	data := `
+	{
+		"variables": {
+			"environment": "dev"
+		},
+
+		"builders": [
+			{
+				"name": "test1",
+				"type": "test-builder"
+			},
+			{
+				"name": "test2",
+				"type": "test-builder"
+			}
+		],
+
+		"provisioners": [
+			{
+				"type": "test-prov",
+				"if": "{{ne (user \"environment\") \"dev\"}}"
+			},
+			{
+				"type": "test-prov",
+				"if": "{{eq build_name \"test2\"}}"
+			}
+		]
+	}
+	`
+
+	template, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, ok := template.Provisioners[0].RawConfig.(map[string]interface{})["if"]; ok {
+		t.Fatal("if should not be in the provisioner config")
+	}
+
+	build, err := template.Build("test1", testTemplateComponentFinder())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cbuild := build.(*coreBuild)
+	if len(cbuild.provisioners) != 0 {
+		t.Fatalf("invalid: %d", len(cbuild.provisioners))
+	}
+
+	build, err = template.Build("test2", testTemplateComponentFinder())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cbuild = build.(*coreBuild)
+	if len(cbuild.provisioners) != 1 {
+		t.Fatalf("invalid: %d", len(cbuild.provisioners))
+	}
+
+	// With the variable set, both run
+	template, err = ParseTemplate([]byte(data), map[string]string{
+		"environment": "prod",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	build, err = template.Build("test2", testTemplateComponentFinder())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cbuild = build.(*coreBuild)
+	if len(cbuild.provisioners) != 2 {
+		t.Fatalf("invalid: %d", len(cbuild.provisioners))
+	}
+}
+
+func TestTemplateBuild_ifPP(t *testing.T) {
+	data := `
+	{
+		"variables": {
+			"publish": ""
+		},
+
+		"builders": [
+			{
+				"name": "test1",
+				"type": "test-builder"
+			}
+		],
+
+		"post-processors": [
+			{
+				"type": "test-pp",
+				"if": "{{user \"publish\"}}"
+			}
+		]
+	}
+	`
+
+	template, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	build, err := template.Build("test1", testTemplateComponentFinder())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cbuild := build.(*coreBuild)
+	if len(cbuild.postProcessors) != 0 {
+		t.Fatalf("invalid: %d", len(cbuild.postProcessors))
+	}
+
+	template, err = ParseTemplate([]byte(data), map[string]string{
+		"publish": "true",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	build, err = template.Build("test1", testTemplateComponentFinder())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cbuild = build.(*coreBuild)
+	if len(cbuild.postProcessors) != 1 {
+		t.Fatalf("invalid: %d", len(cbuild.postProcessors))
+	}
+
+	// Not a bool
+	template, err = ParseTemplate([]byte(data), map[string]string{
+		"publish": "maybe",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := template.Build("test1", testTemplateComponentFinder()); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestParseTemplate_ifInvalid(t *testing.T) {
+	data := `
+	{
+		"builders": [{"type": "test-builder"}],
+
+		"provisioners": [
+			{
+				"type": "test-prov",
+				"if": "{{nope}}"
+			}
+		]
+	}
+	`
+
+	if _, err := ParseTemplate([]byte(data), nil); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
 func TestTemplate_Build_ProvisionerOverride(t *testing.T) {
 	data := `
 	{
@@ -1590,6 +1901,143 @@ func TestTemplateBuild_ProvisionerPauseBefore(t *testing.T) {
 	}
 }
 
+func TestParseTemplate_ProvisionerRetry(t *testing.T) {
+	data := `
+	{
+		"builders": [{"type": "foo"}],
+
+		"provisioners": [
+			{
+				"type": "shell",
+				"max_retries": 3,
+				"retry_backoff": "2s",
+				"timeout": "5m"
+			}
+		]
+	}
+	`
+
+	result, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := result.Provisioners[0]
+	if p.MaxRetries != 3 {
+		t.Fatalf("bad: %d", p.MaxRetries)
+	}
+	if p.retryBackoff != 2*time.Second {
+		t.Fatalf("bad: %s", p.retryBackoff)
+	}
+	if p.timeout != 5*time.Minute {
+		t.Fatalf("bad: %s", p.timeout)
+	}
+
+	config := p.RawConfig.(map[string]interface{})
+	for _, k := range []string{"max_retries", "retry_backoff", "timeout"} {
+		if _, ok := config[k]; ok {
+			t.Fatalf("%s should be removed", k)
+		}
+	}
+}
+
+func TestParseTemplate_ProvisionerRetryInvalid(t *testing.T) {
+	cases := []string{
+		`"max_retries": -1`,
+		`"retry_backoff": "bad"`,
+		`"timeout": "bad"`,
+	}
+
+	for _, tc := range cases {
+		data := `
+		{
+			"builders": [{"type": "foo"}],
+			"provisioners": [{"type": "shell", ` + tc + `}]
+		}
+		`
+
+		if _, err := ParseTemplate([]byte(data), nil); err == nil {
+			t.Fatalf("should have error: %s", tc)
+		}
+	}
+}
+
+func TestTemplateBuild_ProvisionerRetry(t *testing.T) {
+	data := `
+	{
+		"builders": [
+			{
+				"name": "test1",
+				"type": "test-builder"
+			}
+		],
+
+		"provisioners": [
+			{
+				"type": "test-prov",
+				"pause_before": "5s",
+				"max_retries": 2,
+				"retry_backoff": "1s",
+				"timeout": "1m"
+			}
+		]
+	}
+	`
+
+	template, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	provisioner := &MockProvisioner{}
+	components := &ComponentFinder{
+		Builder: func(n string) (Builder, error) { return new(MockBuilder), nil },
+		Provisioner: func(n string) (Provisioner, error) {
+			return provisioner, nil
+		},
+	}
+
+	build, err := template.Build("test1", components)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	coreBuild := build.(*coreBuild)
+	pp, ok := coreBuild.provisioners[0].provisioner.(*PausedProvisioner)
+	if !ok {
+		t.Fatal("should be paused provisioner")
+	}
+
+	rp, ok := pp.Provisioner.(*RetriedProvisioner)
+	if !ok {
+		t.Fatal("should be retried provisioner")
+	}
+	if rp.MaxRetries != 2 || rp.RetryBackoff != time.Second {
+		t.Fatalf("bad: %#v", rp)
+	}
+
+	tp, ok := rp.Provisioner.(*TimeoutProvisioner)
+	if !ok {
+		t.Fatal("should be timeout provisioner")
+	}
+	if tp.Timeout != time.Minute {
+		t.Fatalf("bad: %s", tp.Timeout)
+	}
+	if tp.Provisioner != provisioner {
+		t.Fatal("should wrap the provisioner")
+	}
+
+	// Retries get a new provisioner with the same timeout
+	retryProv, err := rp.NewProvisioner()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tp2, ok := retryProv.(*TimeoutProvisioner)
+	if !ok || tp2 == tp || tp2.Timeout != time.Minute {
+		t.Fatalf("bad: %#v", retryProv)
+	}
+}
+
 func TestTemplateBuild_variables(t *testing.T) {
 	data := `
 	{
@@ -1627,6 +2075,110 @@ func TestTemplateBuild_variables(t *testing.T) {
 	}
 }
 
+func TestTemplateBuild_sensitiveVariables(t *testing.T) {
+	os.Setenv("PACKER_TEST_SECRET", "hunter2")
+	defer os.Setenv("PACKER_TEST_SECRET", "")
+	defer func() { LogSecretFilter.secrets = nil }()
+
+	data := `
+	{
+		"variables": {
+			"secret": "{{env \"PACKER_TEST_SECRET\"}}",
+			"keys": ["key1", "key2"]
+		},
+
+		"sensitive-variables": ["secret", "keys"],
+
+		"builders": [
+			{
+				"name": "test1",
+				"type": "test-builder"
+			}
+		]
+	}
+	`
+
+	template, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := template.Build("test1", testComponentFinder()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := LogSecretFilter.FilterString("hunter2 key1 key2")
+	expected := "<sensitive> <sensitive> <sensitive>"
+	if actual != expected {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestTemplateBuild_dependsOn(t *testing.T) {
+	data := `
+	{
+		"builders": [
+			{"type": "test-builder", "name": "base"},
+			{"type": "test-builder", "name": "child", "depends_on": ["base"]}
+		]
+	}
+	`
+
+	template, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	build, err := template.Build("child", testComponentFinder())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(build.DependsOn(), []string{"base"}) {
+		t.Fatalf("bad: %#v", build.DependsOn())
+	}
+}
+
+func TestTemplateBuild_variablesStructured(t *testing.T) {
+	os.Setenv("PACKER_TEST_MIRROR", "example.com")
+	defer os.Setenv("PACKER_TEST_MIRROR", "")
+
+	data := `
+	{
+		"variables": {
+			"mirrors": ["http://{{env \"PACKER_TEST_MIRROR\"}}/a.iso"]
+		},
+
+		"builders": [
+			{
+				"name": "test1",
+				"type": "test-builder"
+			}
+		]
+	}
+	`
+
+	template, err := ParseTemplate([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	build, err := template.Build("test1", testComponentFinder())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	coreBuild, ok := build.(*coreBuild)
+	if !ok {
+		t.Fatalf("couldn't convert!")
+	}
+
+	expected := map[string]string{"mirrors": `["http://example.com/a.iso"]`}
+	if !reflect.DeepEqual(coreBuild.variables, expected) {
+		t.Fatalf("bad vars: %#v", coreBuild.variables)
+	}
+}
+
 func TestTemplateBuild_variablesRequiredNotSet(t *testing.T) {
 	data := `
 	{
@@ -178,6 +178,7 @@ func (rw *BasicUi) Ask(query string) (string, error) {
 	signal.Notify(sigCh, os.Interrupt)
 	defer signal.Stop(sigCh)
 
+	query = LogSecretFilter.FilterString(query)
 	log.Printf("ui: ask: %s", query)
 	if query != "" {
 		if _, err := fmt.Fprint(rw.Writer, query+" "); err != nil {
@@ -214,6 +215,7 @@ func (rw *BasicUi) Say(message string) {
 	rw.l.Lock()
 	defer rw.l.Unlock()
 
+	message = LogSecretFilter.FilterString(message)
 	log.Printf("ui: %s", message)
 	_, err := fmt.Fprint(rw.Writer, message+"\n")
 	if err != nil {
@@ -225,6 +227,7 @@ func (rw *BasicUi) Message(message string) {
 	rw.l.Lock()
 	defer rw.l.Unlock()
 
+	message = LogSecretFilter.FilterString(message)
 	log.Printf("ui: %s", message)
 	_, err := fmt.Fprint(rw.Writer, message+"\n")
 	if err != nil {
@@ -241,6 +244,7 @@ func (rw *BasicUi) Error(message string) {
 		writer = rw.Writer
 	}
 
+	message = LogSecretFilter.FilterString(message)
 	log.Printf("ui error: %s", message)
 	_, err := fmt.Fprint(writer, message+"\n")
 	if err != nil {
@@ -281,7 +285,8 @@ func (u *MachineReadableUi) Machine(category string, args ...string) {
 
 	// Prepare the args
 	for i, v := range args {
-		args[i] = strings.Replace(v, ",", "%!(PACKER_COMMA)", -1)
+		args[i] = LogSecretFilter.FilterString(v)
+		args[i] = strings.Replace(args[i], ",", "%!(PACKER_COMMA)", -1)
 		args[i] = strings.Replace(args[i], "\r", "\\r", -1)
 		args[i] = strings.Replace(args[i], "\n", "\\n", -1)
 	}
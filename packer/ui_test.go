@@ -237,3 +237,35 @@ func TestMachineReadableUi(t *testing.T) {
 		t.Fatalf("bad: %#v", data)
 	}
 }
+
+func TestBasicUi_sensitive(t *testing.T) {
+	LogSecretFilter.Set("hunter2")
+	defer func() { LogSecretFilter.secrets = nil }()
+
+	bufferUi := testUi()
+	bufferUi.Say("password is hunter2")
+	actual := readWriter(bufferUi)
+	if actual != "password is <sensitive>\n" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	bufferUi.Error("hunter2")
+	actual = readErrorWriter(bufferUi)
+	if actual != "<sensitive>\n" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestMachineReadableUi_sensitive(t *testing.T) {
+	LogSecretFilter.Set("hunter2")
+	defer func() { LogSecretFilter.secrets = nil }()
+
+	buf := new(bytes.Buffer)
+	ui := &MachineReadableUi{Writer: buf}
+	ui.Say("password is hunter2")
+	data := strings.SplitN(buf.String(), ",", 2)[1]
+	expected := ",ui,say,password is <sensitive>\n"
+	if data != expected {
+		t.Fatalf("bad: %#v", data)
+	}
+}
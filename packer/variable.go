@@ -0,0 +1,238 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"strconv"
+	"strings"
+)
+
+// The types that a user variable can be declared as. Values of every
+// type are kept as strings so they can be passed to plugins as user
+// variables: lists and maps are encoded as JSON.
+const (
+	VariableTypeString = "string"
+	VariableTypeList   = "list"
+	VariableTypeMap    = "map"
+	VariableTypeBool   = "bool"
+	VariableTypeNumber = "number"
+)
+
+// parseRawVariable parses the definition of a user variable within the
+// "variables" section of a template. The definition is either the default
+// value itself, or an object declaring the type and default:
+//
+//	{"type": "list", "default": ["a", "b"]}
+//
+// Variables without a declared type are strings, unless the default is a
+// list or a map.
+func parseRawVariable(raw interface{}) (RawVariable, error) {
+	var result RawVariable
+	result.Type = VariableTypeString
+
+	if decl, ok := variableDeclaration(raw); ok {
+		result.Type = decl["type"].(string)
+		raw = decl["default"]
+	} else {
+		switch raw.(type) {
+		case []interface{}:
+			result.Type = VariableTypeList
+		case map[string]interface{}:
+			result.Type = VariableTypeMap
+		}
+	}
+
+	if raw == nil {
+		result.Required = true
+		return result, nil
+	}
+
+	var err error
+	switch result.Type {
+	case VariableTypeList, VariableTypeMap:
+		var encoded []byte
+		encoded, err = json.Marshal(raw)
+		if err == nil {
+			result.Default, err = convertVariable(result.Type, string(encoded))
+		}
+	default:
+		// Scalar defaults are weakly typed, so that numbers and such can
+		// be given as their JSON type or as a string.
+		var decoder *mapstructure.Decoder
+		decoder, err = mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			Result:           &result.Default,
+			WeaklyTypedInput: true,
+		})
+		if err != nil {
+			// This should never happen.
+			panic(err)
+		}
+
+		if err = decoder.Decode(raw); err == nil {
+			result.Default, err = convertVariable(result.Type, result.Default)
+		}
+	}
+
+	return result, err
+}
+
+// variableDeclaration returns the raw variable as a declaration if it is
+// one: an object with a valid "type" and at most a "default" besides.
+func variableDeclaration(raw interface{}) (map[string]interface{}, bool) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	typ, ok := m["type"].(string)
+	if !ok || !validVariableType(typ) {
+		return nil, false
+	}
+
+	for k := range m {
+		if k != "type" && k != "default" {
+			return nil, false
+		}
+	}
+
+	return m, true
+}
+
+func validVariableType(typ string) bool {
+	switch typ {
+	case VariableTypeString, VariableTypeList, VariableTypeMap,
+		VariableTypeBool, VariableTypeNumber:
+		return true
+	}
+
+	return false
+}
+
+// convertVariable type checks the string value of a user variable and
+// returns it in its canonical form. Lists may be given as JSON or as a
+// comma separated string. Maps must be given as JSON.
+func convertVariable(typ string, value string) (string, error) {
+	switch typ {
+	case VariableTypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("expected a bool, got '%s'", value)
+		}
+
+		return strconv.FormatBool(b), nil
+	case VariableTypeNumber:
+		value = strings.TrimSpace(value)
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("expected a number, got '%s'", value)
+		}
+
+		return value, nil
+	case VariableTypeList:
+		var list []interface{}
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			if err := json.Unmarshal([]byte(value), &list); err != nil {
+				return "", fmt.Errorf("expected a list: %s", err)
+			}
+		} else if value != "" {
+			for _, v := range strings.Split(value, ",") {
+				list = append(list, v)
+			}
+		}
+
+		if list == nil {
+			list = make([]interface{}, 0)
+		}
+
+		encoded, err := json.Marshal(list)
+		return string(encoded), err
+	case VariableTypeMap:
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &m); err != nil || m == nil {
+			return "", fmt.Errorf("expected a map as a JSON object, got '%s'", value)
+		}
+
+		encoded, err := json.Marshal(m)
+		return string(encoded), err
+	}
+
+	return value, nil
+}
+
+// processVariable processes the templates within the value of a user
+// variable. For lists and maps, each string within is processed on its
+// own so that the result is still valid JSON.
+func processVariable(tpl *ConfigTemplate, typ string, value string) (string, error) {
+	if typ != VariableTypeList && typ != VariableTypeMap {
+		return tpl.Process(value, nil)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return "", err
+	}
+
+	decoded, err := processVariableValue(tpl, decoded)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(decoded)
+	return string(encoded), err
+}
+
+func processVariableValue(tpl *ConfigTemplate, v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return tpl.Process(v, nil)
+	case []interface{}:
+		for i, elem := range v {
+			if v[i], err = processVariableValue(tpl, elem); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k, elem := range v {
+			if v[k], err = processVariableValue(tpl, elem); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// sensitiveValues returns the values to mask in output for a sensitive
+// variable: the value itself and, for lists and maps, every string within
+// it since those show up in output on their own too.
+func sensitiveValues(typ string, value string) []string {
+	result := []string{value}
+	if typ != VariableTypeList && typ != VariableTypeMap {
+		return result
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return result
+	}
+
+	var collect func(interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			result = append(result, v)
+		case []interface{}:
+			for _, elem := range v {
+				collect(elem)
+			}
+		case map[string]interface{}:
+			for _, elem := range v {
+				collect(elem)
+			}
+		}
+	}
+	collect(decoded)
+
+	return result
+}
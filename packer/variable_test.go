@@ -0,0 +1,88 @@
+package packer
+
+import (
+	"testing"
+)
+
+func TestParseRawVariable(t *testing.T) {
+	cases := []struct {
+		Input    interface{}
+		Type     string
+		Default  string
+		Required bool
+		Err      bool
+	}{
+		{"foo", VariableTypeString, "foo", false, false},
+		{float64(27), VariableTypeString, "27", false, false},
+		{nil, VariableTypeString, "", true, false},
+		{[]interface{}{"a", "b"}, VariableTypeList, `["a","b"]`, false, false},
+		{map[string]interface{}{"a": "b"}, VariableTypeMap, `{"a":"b"}`, false, false},
+		{
+			map[string]interface{}{"type": "bool", "default": true},
+			VariableTypeBool, "true", false, false,
+		},
+		{
+			map[string]interface{}{"type": "number", "default": "42"},
+			VariableTypeNumber, "42", false, false,
+		},
+		{
+			map[string]interface{}{"type": "list"},
+			VariableTypeList, "", true, false,
+		},
+		{
+			map[string]interface{}{"type": "number", "default": "nope"},
+			"", "", false, true,
+		},
+		{
+			// Not a declaration, since it has other keys
+			map[string]interface{}{"type": "list", "other": "foo"},
+			VariableTypeMap, `{"other":"foo","type":"list"}`, false, false,
+		},
+	}
+
+	for _, tc := range cases {
+		v, err := parseRawVariable(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %#v\n\n%s", tc.Input, err)
+		}
+		if tc.Err {
+			continue
+		}
+
+		if v.Type != tc.Type || v.Default != tc.Default || v.Required != tc.Required {
+			t.Fatalf("bad: %#v\n\n%#v", tc.Input, v)
+		}
+	}
+}
+
+func TestConvertVariable(t *testing.T) {
+	cases := []struct {
+		Type   string
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{VariableTypeString, "[foo]", "[foo]", false},
+		{VariableTypeBool, "1", "true", false},
+		{VariableTypeBool, "yes", "", true},
+		{VariableTypeNumber, " 3.5", "3.5", false},
+		{VariableTypeNumber, "three", "", true},
+		{VariableTypeList, "a,b", `["a","b"]`, false},
+		{VariableTypeList, `["a", 2]`, `["a",2]`, false},
+		{VariableTypeList, "", `[]`, false},
+		{VariableTypeList, `[a`, "", true},
+		{VariableTypeMap, `{"a": "b"}`, `{"a":"b"}`, false},
+		{VariableTypeMap, "a=b", "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := convertVariable(tc.Type, tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %s %s\n\n%s", tc.Type, tc.Input, err)
+		}
+
+		if actual != tc.Output {
+			t.Fatalf("bad: %s %s\n\n%s", tc.Type, tc.Input, actual)
+		}
+	}
+}
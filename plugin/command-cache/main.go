@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/mitchellh/packer/command/cache"
+	"github.com/mitchellh/packer/packer/plugin"
+)
+
+func main() {
+	server, err := plugin.Server()
+	if err != nil {
+		panic(err)
+	}
+	server.RegisterCommand(new(cache.Command))
+	server.Serve()
+}
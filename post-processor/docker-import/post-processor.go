@@ -32,7 +32,7 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 	if err != nil {
 		return err
 	}
-	p.config.tpl.UserVars = p.config.PackerUserVars
+	p.config.ConfigureTemplate(p.config.tpl)
 
 	// Accumulate any errors
 	errs := new(packer.MultiError)
@@ -0,0 +1,206 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/packer/common"
+	"github.com/mitchellh/packer/common/filelock"
+	"github.com/mitchellh/packer/common/uuid"
+	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunUUIDEnvVar is the environment variable that Packer sets to the UUID
+// of the run, so that all the builds of a run record the same UUID.
+const RunUUIDEnvVar = "PACKER_RUN_UUID"
+
+// How long to wait for other builds to finish writing the manifest.
+const lockTimeout = 1 * time.Minute
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	OutputPath string `mapstructure:"output"`
+
+	tpl *packer.ConfigTemplate
+}
+
+// Build is the record of a single build in the manifest. The times are
+// Unix times.
+type Build struct {
+	Name           string   `json:"name"`
+	BuilderType    string   `json:"builder_type"`
+	BuilderId      string   `json:"builder_id"`
+	ArtifactId     string   `json:"artifact_id"`
+	Files          []string `json:"files"`
+	BuildStartTime int64    `json:"build_start_time"`
+	BuildEndTime   int64    `json:"build_end_time"`
+	PackerRunUUID  string   `json:"packer_run_uuid"`
+}
+
+// Manifest is the contents of the manifest file. Every run appends the
+// records of its builds to it.
+type Manifest struct {
+	Builds      []Build `json:"builds"`
+	LastRunUUID string  `json:"last_run_uuid"`
+}
+
+type PostProcessor struct {
+	config    Config
+	runId     string
+	startTime time.Time
+}
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	_, err := common.DecodeConfig(&p.config, raws...)
+	if err != nil {
+		return err
+	}
+
+	p.config.tpl, err = packer.NewConfigTemplate()
+	if err != nil {
+		return err
+	}
+	p.config.ConfigureTemplate(p.config.tpl)
+
+	if p.config.OutputPath == "" {
+		p.config.OutputPath = "packer-manifest.json"
+	}
+
+	p.config.OutputPath, err = p.config.tpl.Process(p.config.OutputPath, nil)
+	if err != nil {
+		return fmt.Errorf("Error processing output: %s", err)
+	}
+
+	p.runId = os.Getenv(RunUUIDEnvVar)
+	if p.runId == "" {
+		p.runId = uuid.TimeOrderedUUID()
+	}
+
+	// Post-processors are configured when the build is prepared, right
+	// before it runs, so this is taken as the start of the build. With
+	// -parallel-builds, this includes the time waiting for a free slot.
+	p.startTime = time.Now()
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
+	files := artifact.Files()
+	if files == nil {
+		files = make([]string, 0)
+	}
+
+	build := Build{
+		Name:           p.config.PackerBuildName,
+		BuilderType:    p.config.PackerBuilderType,
+		BuilderId:      artifact.BuilderId(),
+		ArtifactId:     artifact.Id(),
+		Files:          files,
+		BuildStartTime: p.startTime.Unix(),
+		BuildEndTime:   time.Now().Unix(),
+		PackerRunUUID:  p.runId,
+	}
+
+	ui.Message(fmt.Sprintf("Adding build '%s' to manifest: %s", build.Name, p.config.OutputPath))
+	if err := appendBuild(p.config.OutputPath, build); err != nil {
+		return nil, false, fmt.Errorf("Error writing manifest: %s", err)
+	}
+
+	// The artifact is handed back untouched and kept, so the artifact the
+	// manifest records isn't deleted at the end of the sequence.
+	return artifact, true, nil
+}
+
+// appendBuild adds the build to the manifest at path, creating it if it
+// doesn't exist. The builds of a run write the manifest from separate
+// processes, so it is only changed while holding the lock.
+func appendBuild(path string, build Build) error {
+	unlock, err := lock(path+".lock", lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var manifest Manifest
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return fmt.Errorf("Error parsing existing manifest '%s': %s", path, err)
+		}
+	}
+
+	manifest.Builds = append(manifest.Builds, build)
+	manifest.LastRunUUID = build.PackerRunUUID
+
+	data, err = json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a failure halfway through
+	// doesn't lose the records of earlier runs.
+	dir := filepath.Dir(path)
+	tf, err := ioutil.TempFile(dir, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tf.Write(append(data, '\n'))
+	if closeErr := tf.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tf.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(tf.Name())
+		return err
+	}
+
+	if err := os.Rename(tf.Name(), path); err != nil {
+		os.Remove(tf.Name())
+		return err
+	}
+
+	return nil
+}
+
+// lock locks the lock file, waiting for up to the timeout for whoever
+// holds it to release it. It returns the function to release the lock.
+// The lock is taken with the operating system, so it is released even
+// if Packer is killed.
+func lock(path string, timeout time.Duration) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := filelock.Lock(f, true, false)
+		if err == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf(
+				"Timeout waiting for lock '%s': %s", path, err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return func() {
+		filelock.Unlock(f)
+		f.Close()
+	}, nil
+}
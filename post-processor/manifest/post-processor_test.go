@@ -0,0 +1,165 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func testConfig(output string) map[string]interface{} {
+	return map[string]interface{}{
+		"output":              output,
+		"packer_build_name":   "foo",
+		"packer_builder_type": "virtualbox-iso",
+	}
+}
+
+func testUi() *packer.BasicUi {
+	return &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+}
+
+func testManifest(t *testing.T, path string) *Manifest {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var result Manifest
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return &result
+}
+
+func TestPostProcessor_ImplementsPostProcessor(t *testing.T) {
+	var _ packer.PostProcessor = new(PostProcessor)
+}
+
+func TestPostProcessorConfigure_defaults(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(testConfig("")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.OutputPath != "packer-manifest.json" {
+		t.Fatalf("bad: %s", p.config.OutputPath)
+	}
+}
+
+func TestPostProcessorConfigure_runUUID(t *testing.T) {
+	old := os.Getenv(RunUUIDEnvVar)
+	defer os.Setenv(RunUUIDEnvVar, old)
+	os.Setenv(RunUUIDEnvVar, "run")
+
+	var p PostProcessor
+	if err := p.Configure(testConfig("")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.runId != "run" {
+		t.Fatalf("bad: %s", p.runId)
+	}
+}
+
+func TestPostProcessorPostProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.json")
+
+	// A lock file left behind by a Packer that was killed doesn't block
+	if err := ioutil.WriteFile(path+".lock", nil, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Two runs append to the same manifest
+	for i := 0; i < 2; i++ {
+		var p PostProcessor
+		if err := p.Configure(testConfig(path)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		artifact := &packer.MockArtifact{IdValue: fmt.Sprintf("id%d", i)}
+		result, keep, err := p.PostProcess(testUi(), artifact)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if result != artifact {
+			t.Fatal("should return the artifact")
+		}
+		if !keep {
+			t.Fatal("should keep the artifact")
+		}
+	}
+
+	manifest := testManifest(t, path)
+	if len(manifest.Builds) != 2 {
+		t.Fatalf("bad: %#v", manifest.Builds)
+	}
+
+	build := manifest.Builds[1]
+	if build.Name != "foo" || build.BuilderType != "virtualbox-iso" {
+		t.Fatalf("bad: %#v", build)
+	}
+	if build.ArtifactId != "id1" {
+		t.Fatalf("bad: %#v", build)
+	}
+	if build.BuildStartTime == 0 || build.BuildEndTime < build.BuildStartTime {
+		t.Fatalf("bad: %#v", build)
+	}
+	if manifest.LastRunUUID != build.PackerRunUUID {
+		t.Fatalf("bad: %#v", manifest)
+	}
+}
+
+func TestPostProcessorPostProcess_concurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var p PostProcessor
+			if err := p.Configure(testConfig(path)); err != nil {
+				errs <- err
+				return
+			}
+
+			if _, _, err := p.PostProcess(testUi(), new(packer.MockArtifact)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("err: %s", err)
+	}
+
+	if manifest := testManifest(t, path); len(manifest.Builds) != 10 {
+		t.Fatalf("bad: %d", len(manifest.Builds))
+	}
+}
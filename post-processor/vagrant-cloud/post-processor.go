@@ -44,7 +44,7 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 	if err != nil {
 		return err
 	}
-	p.config.tpl.UserVars = p.config.PackerUserVars
+	p.config.ConfigureTemplate(p.config.tpl)
 
 	// Default configuration
 	if p.config.VagrantCloudUrl == "" {
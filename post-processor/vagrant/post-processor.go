@@ -168,7 +168,7 @@ func (p *PostProcessor) configureSingle(config *Config, raws ...interface{}) err
 	if err != nil {
 		return err
 	}
-	config.tpl.UserVars = config.PackerUserVars
+	config.ConfigureTemplate(config.tpl)
 
 	// Defaults
 	if config.OutputPath == "" {
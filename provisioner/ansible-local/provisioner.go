@@ -62,7 +62,7 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		return err
 	}
 
-	p.config.tpl.UserVars = p.config.PackerUserVars
+	p.config.ConfigureTemplate(p.config.tpl)
 
 	// Accumulate any errors
 	errs := common.CheckUnusedConfig(md)
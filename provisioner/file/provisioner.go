@@ -1,11 +1,16 @@
 package file
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/mitchellh/packer/common"
 	"github.com/mitchellh/packer/packer"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 type config struct {
@@ -14,9 +19,21 @@ type config struct {
 	// The local path of the file to upload.
 	Source string
 
+	// An array of multiple local paths to upload. These may contain
+	// glob patterns.
+	Sources []string
+
 	// The remote path where the local file will be uploaded to.
 	Destination string
 
+	// Direction is either "upload" (the default) or "download". When
+	// downloading, Source is the remote path and Destination is local.
+	Direction string
+
+	// If true, the contents of each file are processed as a configuration
+	// template before being uploaded.
+	Template bool
+
 	tpl *packer.ConfigTemplate
 }
 
@@ -24,6 +41,13 @@ type Provisioner struct {
 	config config
 }
 
+// FileTemplate is the data available when processing the contents of
+// files with "template" enabled.
+type FileTemplate struct {
+	BuildName   string
+	BuilderType string
+}
+
 func (p *Provisioner) Prepare(raws ...interface{}) error {
 	md, err := common.DecodeConfig(&p.config, raws...)
 	if err != nil {
@@ -34,14 +58,31 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 	if err != nil {
 		return err
 	}
-	p.config.tpl.UserVars = p.config.PackerUserVars
+	p.config.ConfigureTemplate(p.config.tpl)
 
 	// Accumulate any errors
 	errs := common.CheckUnusedConfig(md)
 
+	if p.config.Direction == "" {
+		p.config.Direction = "upload"
+	}
+
+	if p.config.Sources == nil {
+		p.config.Sources = make([]string, 0)
+	}
+
+	if p.config.Source != "" && len(p.config.Sources) > 0 {
+		errs = packer.MultiErrorAppend(errs,
+			errors.New("Only one of source or sources can be specified."))
+	}
+
+	if p.config.Source != "" {
+		p.config.Sources = []string{p.config.Source}
+	}
+
 	templates := map[string]*string{
-		"source":      &p.config.Source,
 		"destination": &p.config.Destination,
+		"direction":   &p.config.Direction,
 	}
 
 	for n, ptr := range templates {
@@ -53,9 +94,60 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		}
 	}
 
-	if _, err := os.Stat(p.config.Source); err != nil {
+	for i, source := range p.config.Sources {
+		var err error
+		p.config.Sources[i], err = p.config.tpl.Process(source, nil)
+		if err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Error processing sources[%d]: %s", i, err))
+		}
+	}
+
+	if len(p.config.Sources) == 0 {
+		errs = packer.MultiErrorAppend(errs,
+			errors.New("Either source or sources must be specified."))
+	}
+
+	switch p.config.Direction {
+	case "upload":
+		for _, source := range p.config.Sources {
+			paths, err := expandSource(source)
+			if err != nil {
+				errs = packer.MultiErrorAppend(errs, err)
+				continue
+			}
+
+			if !p.config.Template {
+				continue
+			}
+
+			for _, path := range paths {
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					errs = packer.MultiErrorAppend(errs, fmt.Errorf(
+						"Bad source '%s': template can only be used with files", path))
+				}
+			}
+		}
+	case "download":
+		if p.config.Template {
+			errs = packer.MultiErrorAppend(errs,
+				errors.New("Template can only be used when uploading."))
+		}
+
+		if len(p.config.Sources) > 1 && !strings.HasSuffix(p.config.Destination, "/") {
+			errs = packer.MultiErrorAppend(errs, errors.New(
+				"Destination must be a directory ending in '/' when downloading multiple sources."))
+		}
+
+		for _, source := range p.config.Sources {
+			if strings.HasSuffix(source, "/") && !strings.HasSuffix(p.config.Destination, "/") {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf(
+					"Bad source '%s': destination must be a directory ending in '/' when downloading a directory.", source))
+			}
+		}
+	default:
 		errs = packer.MultiErrorAppend(errs,
-			fmt.Errorf("Bad source '%s': %s", p.config.Source, err))
+			fmt.Errorf("Direction must be one of: upload, download"))
 	}
 
 	if p.config.Destination == "" {
@@ -71,33 +163,169 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 }
 
 func (p *Provisioner) Provision(ui packer.Ui, comm packer.Communicator) error {
-	ui.Say(fmt.Sprintf("Uploading %s => %s", p.config.Source, p.config.Destination))
-	info, err := os.Stat(p.config.Source)
+	if p.config.Direction == "download" {
+		for _, source := range p.config.Sources {
+			if err := p.provisionDownload(ui, comm, source); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// Expand all the globs up front, since that determines whether
+	// the destination is a directory or not.
+	paths := make([]string, 0, len(p.config.Sources))
+	for _, source := range p.config.Sources {
+		expanded, err := expandSource(source)
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, expanded...)
+	}
+
+	// With more than one file, or a trailing slash, the destination is
+	// a remote directory and every file keeps its own name within it.
+	dstIsDir := len(paths) > 1 || strings.HasSuffix(p.config.Destination, "/")
+
+	for _, path := range paths {
+		if err := p.provisionUpload(ui, comm, path, dstIsDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Provisioner) provisionUpload(ui packer.Ui, comm packer.Communicator, src string, dstIsDir bool) error {
+	info, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
 
 	// If we're uploading a directory, short circuit and do that
 	if info.IsDir() {
-		return comm.UploadDir(p.config.Destination, p.config.Source, nil)
+		ui.Say(fmt.Sprintf("Uploading %s => %s", src, p.config.Destination))
+		return comm.UploadDir(p.config.Destination, src, nil)
+	}
+
+	dst := p.config.Destination
+	if dstIsDir {
+		dst = strings.TrimRight(dst, "/") + "/" + filepath.Base(src)
 	}
 
+	ui.Say(fmt.Sprintf("Uploading %s => %s", src, dst))
+
 	// We're uploading a file...
-	f, err := os.Open(p.config.Source)
+	f, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	err = comm.Upload(p.config.Destination, f)
+	var r io.Reader = f
+	if p.config.Template {
+		r, err = p.processTemplate(f)
+		if err != nil {
+			err = fmt.Errorf("Error processing template '%s': %s", src, err)
+			ui.Error(err.Error())
+			return err
+		}
+	}
+
+	err = comm.Upload(dst, r)
 	if err != nil {
 		ui.Error(fmt.Sprintf("Upload failed: %s", err))
 	}
 	return err
 }
 
+func (p *Provisioner) provisionDownload(ui packer.Ui, comm packer.Communicator, src string) error {
+	ui.Say(fmt.Sprintf("Downloading %s => %s", src, p.config.Destination))
+
+	// If the destination ends in a slash then it is a local directory
+	// and we download into it, following the same trailing slash rules
+	// for the source as directory uploads.
+	dst := p.config.Destination
+	if dst[len(dst)-1] == '/' {
+		err := comm.DownloadDir(src, dst, nil)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Download failed: %s", err))
+		}
+		return err
+	}
+
+	// We're downloading a single file, make sure the directory it
+	// goes into exists.
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = comm.Download(src, f)
+	f.Close()
+	if err != nil {
+		// Don't leave a partial file behind. The source may well be a
+		// directory, which can't be told apart from other failures
+		// without asking the remote side, so point that out.
+		os.Remove(dst)
+		err = fmt.Errorf(
+			"%s\n\nIf '%s' is a directory, end the destination with a '/' "+
+				"to download it into a local directory.", err, src)
+		ui.Error(fmt.Sprintf("Download failed: %s", err))
+	}
+	return err
+}
+
+// processTemplate reads all of r and processes it as a configuration
+// template, returning a reader for the result.
+func (p *Provisioner) processTemplate(r io.Reader) (io.Reader, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tplData := &FileTemplate{
+		BuildName:   p.config.PackerBuildName,
+		BuilderType: p.config.PackerBuilderType,
+	}
+
+	result, err := p.config.tpl.Process(string(contents), tplData)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBufferString(result), nil
+}
+
 func (p *Provisioner) Cancel() {
 	// Just hard quit. It isn't a big deal if what we're doing keeps
 	// running on the other side.
 	os.Exit(0)
 }
+
+// expandSource expands any glob pattern in the source into the list of
+// matching paths. A source without a pattern must exist.
+func expandSource(source string) ([]string, error) {
+	paths, err := filepath.Glob(source)
+	if err != nil {
+		return nil, fmt.Errorf("Bad source '%s': %s", source, err)
+	}
+
+	if len(paths) == 0 {
+		// Glob doesn't return an error for paths that don't exist,
+		// so stat it to get a proper error message.
+		if _, err := os.Stat(source); err != nil {
+			return nil, fmt.Errorf("Bad source '%s': %s", source, err)
+		}
+
+		return nil, fmt.Errorf("Bad source '%s': no files match", source)
+	}
+
+	return paths, nil
+}
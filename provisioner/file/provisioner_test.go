@@ -1,9 +1,12 @@
 package file
 
 import (
+	"fmt"
 	"github.com/mitchellh/packer/packer"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -63,6 +66,45 @@ func TestProvisionerPrepare_ValidSource(t *testing.T) {
 	}
 }
 
+func TestProvisionerPrepare_Direction(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["source"] = "/this/is/on/the/remote/side"
+	config["direction"] = "download"
+
+	err := p.Prepare(config)
+	if err != nil {
+		t.Fatalf("should not check remote source: %s", err)
+	}
+
+	config["direction"] = "sideways"
+	p = Provisioner{}
+	err = p.Prepare(config)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerPrepare_DownloadDirectory(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["source"] = "/var/log/installer/"
+	config["destination"] = "logs"
+	config["direction"] = "download"
+
+	err := p.Prepare(config)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	config["destination"] = "logs/"
+	p = Provisioner{}
+	err = p.Prepare(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestProvisionerPrepare_EmptyDestination(t *testing.T) {
 	var p Provisioner
 
@@ -139,3 +181,260 @@ func TestProvisionerProvision_SendsFile(t *testing.T) {
 		t.Fatalf("should upload with source file's data")
 	}
 }
+
+func TestProvisionerProvision_DownloadsFile(t *testing.T) {
+	var p Provisioner
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	dst := filepath.Join(td, "logs", "installer.log")
+	config := map[string]interface{}{
+		"source":      "/var/log/installer.log",
+		"destination": dst,
+		"direction":   "download",
+	}
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := &stubUi{}
+	comm := &packer.MockCommunicator{DownloadData: "hello"}
+	err = p.Provision(ui, comm)
+	if err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	if comm.DownloadPath != "/var/log/installer.log" {
+		t.Fatalf("should download from configured source")
+	}
+
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if string(data) != "hello" {
+		t.Fatalf("should write downloaded data to destination: %q", data)
+	}
+}
+
+func TestProvisionerProvision_DownloadsDir(t *testing.T) {
+	var p Provisioner
+	config := map[string]interface{}{
+		"source":      "/var/log/installer",
+		"destination": "logs/",
+		"direction":   "download",
+	}
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := &stubUi{}
+	comm := &packer.MockCommunicator{}
+	err := p.Provision(ui, comm)
+	if err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	if comm.DownloadDirSrc != "/var/log/installer" {
+		t.Fatalf("bad: %s", comm.DownloadDirSrc)
+	}
+
+	if comm.DownloadDirDst != "logs/" {
+		t.Fatalf("bad: %s", comm.DownloadDirDst)
+	}
+}
+
+// dirCommunicator fails to download any path as a file, like
+// communicators do when the remote path is a directory.
+type dirCommunicator struct {
+	packer.MockCommunicator
+}
+
+func (c *dirCommunicator) Download(path string, w io.Writer) error {
+	return fmt.Errorf("%s: is a directory", path)
+}
+
+func TestProvisionerProvision_DownloadsDirWithoutSlash(t *testing.T) {
+	var p Provisioner
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	dst := filepath.Join(td, "logs")
+	config := map[string]interface{}{
+		"source":      "/var/log/installer",
+		"destination": dst,
+		"direction":   "download",
+	}
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := &stubUi{}
+	err = p.Provision(ui, new(dirCommunicator))
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	if !strings.Contains(err.Error(), "end the destination with a '/'") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		t.Fatal("should not leave the destination file behind")
+	}
+}
+
+func TestProvisionerPrepare_SourceAndSources(t *testing.T) {
+	var p Provisioner
+
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("error tempfile: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	config := testConfig()
+	config["source"] = tf.Name()
+	config["sources"] = []string{tf.Name()}
+
+	err = p.Prepare(config)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerPrepare_SourcesGlob(t *testing.T) {
+	var p Provisioner
+
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	config := testConfig()
+	config["sources"] = []string{filepath.Join(td, "*.txt")}
+
+	err = p.Prepare(config)
+	if err == nil {
+		t.Fatal("should require at least one match")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(td, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p = Provisioner{}
+	err = p.Prepare(config)
+	if err != nil {
+		t.Fatalf("should allow matching glob: %s", err)
+	}
+}
+
+func TestProvisionerPrepare_TemplateDirectory(t *testing.T) {
+	var p Provisioner
+
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	config := testConfig()
+	config["source"] = td
+	config["template"] = true
+
+	err = p.Prepare(config)
+	if err == nil {
+		t.Fatal("should not allow templating directories")
+	}
+}
+
+func TestProvisionerProvision_SendsGlob(t *testing.T) {
+	var p Provisioner
+
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(td, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	config := map[string]interface{}{
+		"sources":     []string{filepath.Join(td, "*.txt")},
+		"destination": "/tmp",
+	}
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := &stubUi{}
+	comm := &packer.MockCommunicator{}
+	err = p.Provision(ui, comm)
+	if err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	// The mock only records the last upload
+	if comm.UploadPath != "/tmp/b.txt" {
+		t.Fatalf("should upload into destination directory: %s", comm.UploadPath)
+	}
+
+	if !strings.Contains(ui.sayMessages, "/tmp/a.txt") {
+		t.Fatalf("should upload every matching file")
+	}
+}
+
+func TestProvisionerProvision_Template(t *testing.T) {
+	var p Provisioner
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("error tempfile: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	_, err = tf.Write([]byte("{{user `greeting`}} from {{.BuildName}}"))
+	if err != nil {
+		t.Fatalf("error writing tempfile: %s", err)
+	}
+
+	config := map[string]interface{}{
+		"source":                tf.Name(),
+		"destination":           "something",
+		"template":              true,
+		"packer_build_name":     "foo",
+		"packer_user_variables": map[string]string{"greeting": "hello"},
+	}
+
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := &stubUi{}
+	comm := &packer.MockCommunicator{}
+	err = p.Provision(ui, comm)
+	if err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	if comm.UploadData != "hello from foo" {
+		t.Fatalf("should upload processed contents: %q", comm.UploadData)
+	}
+}
@@ -56,6 +56,16 @@ type config struct {
 	// This can be set high to allow for reboots.
 	RawStartRetryTimeout string `mapstructure:"start_retry_timeout"`
 
+	// The exit codes that are treated as a successful run of a script.
+	// By default only 0 is.
+	ValidExitCodes []int `mapstructure:"valid_exit_codes"`
+
+	// If true, a script losing the connection to the machine, such as
+	// by rebooting it, is treated as a success. The next script waits
+	// for the machine to come back. This is true by default, set it to
+	// false to fail when the connection is lost.
+	ExpectDisconnect bool `mapstructure:"expect_disconnect"`
+
 	startRetryTimeout time.Duration
 	tpl               *packer.ConfigTemplate
 }
@@ -79,7 +89,7 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 	if err != nil {
 		return err
 	}
-	p.config.tpl.UserVars = p.config.PackerUserVars
+	p.config.ConfigureTemplate(p.config.tpl)
 
 	// Accumulate any errors
 	errs := common.CheckUnusedConfig(md)
@@ -108,6 +118,25 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		p.config.Scripts = make([]string, 0)
 	}
 
+	if p.config.ValidExitCodes == nil {
+		p.config.ValidExitCodes = []int{0}
+	}
+
+	// Default ExpectDisconnect if it wasn't set, since scripts that
+	// reboot the machine have always succeeded. Depending on the version
+	// of mapstructure, the key is the field name or the config name.
+	hasExpectDisconnect := false
+	for _, k := range md.Keys {
+		if k == "ExpectDisconnect" || k == "expect_disconnect" {
+			hasExpectDisconnect = true
+			break
+		}
+	}
+
+	if !hasExpectDisconnect {
+		p.config.ExpectDisconnect = true
+	}
+
 	if p.config.Vars == nil {
 		p.config.Vars = make([]string, 0)
 	}
@@ -283,7 +312,10 @@ func (p *Provisioner) Provision(ui packer.Ui, comm packer.Communicator) error {
 			}
 			cmd.Wait()
 
-			cmd = &packer.RemoteCmd{Command: command}
+			cmd = &packer.RemoteCmd{
+				Command:          command,
+				ReportDisconnect: true,
+			}
 			return cmd.StartWithUi(comm, ui)
 		})
 		if err != nil {
@@ -293,8 +325,22 @@ func (p *Provisioner) Provision(ui packer.Ui, comm packer.Communicator) error {
 		// Close the original file since we copied it
 		f.Close()
 
-		if cmd.ExitStatus != 0 {
-			return fmt.Errorf("Script exited with non-zero exit status: %d", cmd.ExitStatus)
+		if cmd.ExitStatus == packer.CmdDisconnect {
+			if !p.config.ExpectDisconnect {
+				return errors.New(
+					"Script disconnected unexpectedly. If the script is expected " +
+						"to disconnect, such as by rebooting the machine, remove " +
+						"expect_disconnect or set it to true.")
+			}
+
+			ui.Say("Script disconnected, as expected.")
+			continue
+		}
+
+		if !p.validExitCode(cmd.ExitStatus) {
+			return fmt.Errorf(
+				"Script exited with exit status %d, which is not in valid_exit_codes: %v",
+				cmd.ExitStatus, p.config.ValidExitCodes)
 		}
 	}
 
@@ -307,6 +353,18 @@ func (p *Provisioner) Cancel() {
 	os.Exit(0)
 }
 
+// validExitCode returns true if the exit status of a script is one of
+// the valid exit codes.
+func (p *Provisioner) validExitCode(status int) bool {
+	for _, code := range p.config.ValidExitCodes {
+		if status == code {
+			return true
+		}
+	}
+
+	return false
+}
+
 // retryable will retry the given function over and over until a
 // non-error is returned.
 func (p *Provisioner) retryable(f func() error) error {
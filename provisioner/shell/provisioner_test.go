@@ -1,9 +1,12 @@
 package shell
 
 import (
+	"bytes"
 	"github.com/mitchellh/packer/packer"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -199,3 +202,93 @@ func TestProvisionerPrepare_EnvironmentVars(t *testing.T) {
 		t.Fatalf("should not have error: %s", err)
 	}
 }
+
+func TestProvisionerPrepare_ValidExitCodes(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+
+	err := p.Prepare(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(p.config.ValidExitCodes, []int{0}) {
+		t.Fatalf("bad: %#v", p.config.ValidExitCodes)
+	}
+
+	config["valid_exit_codes"] = []interface{}{0, 2}
+	p = Provisioner{}
+	err = p.Prepare(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(p.config.ValidExitCodes, []int{0, 2}) {
+		t.Fatalf("bad: %#v", p.config.ValidExitCodes)
+	}
+}
+
+func testProvisionExitStatus(t *testing.T, config map[string]interface{}, status int) error {
+	var p Provisioner
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+	comm := &packer.MockCommunicator{StartExitStatus: status}
+	return p.Provision(ui, comm)
+}
+
+func TestProvisionerProvision_ValidExitCodes(t *testing.T) {
+	config := testConfig()
+	if err := testProvisionExitStatus(t, config, 0); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := testProvisionExitStatus(t, config, 2); err == nil {
+		t.Fatal("should have error")
+	}
+
+	config["valid_exit_codes"] = []interface{}{0, 2}
+	if err := testProvisionExitStatus(t, config, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := testProvisionExitStatus(t, config, 1); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerProvision_ExpectDisconnect(t *testing.T) {
+	// Disconnecting succeeds by default, as it always has
+	config := testConfig()
+	if err := testProvisionExitStatus(t, config, packer.CmdDisconnect); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config["expect_disconnect"] = false
+	if err := testProvisionExitStatus(t, config, packer.CmdDisconnect); err == nil {
+		t.Fatal("should have error")
+	}
+
+	config["expect_disconnect"] = true
+	if err := testProvisionExitStatus(t, config, packer.CmdDisconnect); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestProvisionerProvision_invalidExitCodeMessage(t *testing.T) {
+	config := testConfig()
+	config["valid_exit_codes"] = []interface{}{2}
+	err := testProvisionExitStatus(t, config, 0)
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	if !strings.Contains(err.Error(), "not in valid_exit_codes") {
+		t.Fatalf("bad: %s", err)
+	}
+}